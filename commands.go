@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/siler23/tezos-hsm-signer/signer"
+	"github.com/siler23/tezos-hsm-signer/signer/watermark"
+)
+
+// runCommand dispatches subcommands provided after the global flags, e.g.
+// `tezos-hsm-signer --watermark-type dynamodb watermark show`
+func runCommand(args []string, wm watermark.Watermark, opFilter *signer.OperationFilter) {
+	switch args[0] {
+	case "watermark":
+		runWatermarkCommand(args[1:], wm)
+	case "decode":
+		runDecodeCommand(args[1:], opFilter)
+	case "policy-test":
+		runPolicyTestCommand(args[1:], opFilter)
+	default:
+		log.Fatalf("Unknown command: %v\n", args[0])
+	}
+}
+
+// runDecodeCommand describes a signing request, provided as an argument or
+// on stdin in the same quoted hex as a POST to /keys/<pkh>, and explains
+// whether the operation filter allows it
+func runDecodeCommand(args []string, opFilter *signer.OperationFilter) {
+	var body []byte
+	var err error
+	if len(args) > 0 {
+		body = []byte(args[0])
+	} else {
+		body, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal("Unable to read the operation: ", err)
+		}
+	}
+	// Accept bare hex for convenience
+	body = []byte(strings.TrimSpace(string(body)))
+	if !strings.HasPrefix(string(body), "\"") {
+		body = []byte("\"" + string(body) + "\"")
+	}
+
+	op, err := signer.ParseOperation(body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(opFilter.Describe(op))
+}
+
+// runPolicyTestCommand judges sample payloads, one quoted or bare hex
+// operation per line of a file or stdin, with the operation filter.  Lines
+// prefixed with "allow" or "deny" are expectations, and the command fails if
+// any isn't met.
+func runPolicyTestCommand(args []string, opFilter *signer.OperationFilter) {
+	flags := flag.NewFlagSet("policy-test", flag.ExitOnError)
+	keyHash := flags.String("key", "", "Public key hash in --keyfile to judge the payloads for")
+	flags.Parse(args)
+
+	var key *signer.Key
+	if len(*keyHash) > 0 {
+		keys := signer.LoadKeyFile(*keyfile)
+		for i := range keys {
+			if keys[i].PublicKeyHash == *keyHash {
+				key = &keys[i]
+			}
+		}
+		if key == nil {
+			log.Fatalln("Key not found:", *keyHash)
+		}
+	}
+
+	input := io.Reader(os.Stdin)
+	if flags.NArg() > 0 {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatal("Unable to read the payloads: ", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	failed := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tRESULT\tRULE\tREASON")
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		expected := ""
+		if fields[0] == "allow" || fields[0] == "deny" {
+			expected, fields = fields[0], fields[1:]
+		}
+		if len(fields) != 1 {
+			log.Fatalf("Line %v: expected an operation, optionally prefixed with allow or deny\n", line)
+		}
+		body := fields[0]
+		if !strings.HasPrefix(body, "\"") {
+			body = "\"" + body + "\""
+		}
+
+		result, rule, reason := "deny", "parse", ""
+		op, err := signer.ParseOperation([]byte(body))
+		if err != nil {
+			reason = err.Error()
+		} else {
+			result, rule, reason = "allow", "", ""
+			for _, decision := range opFilter.ExplainForKey(op, key) {
+				rule, reason = decision.Rule, decision.Reason
+				if !decision.Allowed {
+					result = "deny"
+					break
+				}
+			}
+		}
+		if len(expected) > 0 && expected != result {
+			failed = true
+			result = fmt.Sprintf("%v (FAIL: expected %v)", result, expected)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", line, result, rule, reason)
+	}
+	w.Flush()
+	if err := scanner.Err(); err != nil {
+		log.Fatal("Unable to read the payloads: ", err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runWatermarkCommand inspects and repairs the configured watermark
+func runWatermarkCommand(args []string, wm watermark.Watermark) {
+	if len(args) == 0 {
+		log.Fatal("Usage: watermark <show|set|reset|export|import>")
+	}
+	admin, ok := wm.(watermark.Admin)
+	if !ok {
+		log.Fatalf("--watermark-type %v does not support administration\n", *watermarkType)
+	}
+
+	flags := flag.NewFlagSet("watermark "+args[0], flag.ExitOnError)
+	keyHash := flags.String("key", "", "Public key hash of the watermark entry, or the source address of a generic operation counter")
+	chainID := flags.String("chain-id", "", "Chain ID of the watermark entry")
+	opType := flags.Uint("op-type", 0, "Operation magic byte of the watermark entry, e.g. 1 for blocks, 2 for endorsements or 3 for generic operation counters")
+	level := flags.String("level", "", "Level to set the watermark entry to")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	flags.Parse(args[1:])
+
+	switch args[0] {
+	case "show":
+		entries, err := admin.Entries()
+		if err != nil {
+			log.Fatal("Unable to list watermark entries: ", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tCHAIN ID\tOP TYPE\tLEVEL")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", entry.KeyHash, entry.ChainID, entry.OpType, entry.Level)
+		}
+		w.Flush()
+	case "set":
+		requireEntryFlags(*keyHash, *chainID, *opType)
+		newLevel, ok := new(big.Int).SetString(*level, 10)
+		if !ok {
+			log.Fatal("--level must be a base 10 integer")
+		}
+		current := currentLevel(admin, *keyHash, *chainID, *opType)
+		confirm(*yes, fmt.Sprintf("Set the %v watermark of %v on %v from level %v to level %v?", *opType, *keyHash, *chainID, current, newLevel))
+		if err := admin.SetLevel(*keyHash, *chainID, uint8(*opType), newLevel); err != nil {
+			log.Fatal("Unable to set watermark: ", err)
+		}
+	case "reset":
+		requireEntryFlags(*keyHash, *chainID, *opType)
+		confirm(*yes, fmt.Sprintf("Remove the %v watermark of %v on %v?", *opType, *keyHash, *chainID))
+		if err := admin.Reset(*keyHash, *chainID, uint8(*opType)); err != nil {
+			log.Fatal("Unable to reset watermark: ", err)
+		}
+	case "export":
+		out := io.Writer(os.Stdout)
+		if flags.NArg() > 0 {
+			file, err := os.Create(flags.Arg(0))
+			if err != nil {
+				log.Fatal("Unable to create export file: ", err)
+			}
+			defer file.Close()
+			out = file
+		}
+		if err := watermark.Export(out, admin); err != nil {
+			log.Fatal("Unable to export watermarks: ", err)
+		}
+	case "import":
+		in := io.Reader(os.Stdin)
+		if flags.NArg() > 0 {
+			file, err := os.Open(flags.Arg(0))
+			if err != nil {
+				log.Fatal("Unable to open import file: ", err)
+			}
+			defer file.Close()
+			in = file
+		}
+		written, err := watermark.Import(in, admin)
+		if err != nil {
+			log.Fatalf("Unable to import watermarks after writing %v entries: %v\n", written, err)
+		}
+		log.Printf("Imported %v watermark entries\n", written)
+	default:
+		log.Fatalf("Unknown watermark command: %v\n", args[0])
+	}
+}
+
+// requireEntryFlags identifying a single watermark entry.  Only generic
+// operation counters may be scoped to no chain, when --generic-chain-id isn't
+// set.
+func requireEntryFlags(keyHash string, chainID string, opType uint) {
+	if len(keyHash) == 0 || opType == 0 || opType > 0xff {
+		log.Fatal("--key and --op-type are required")
+	}
+	if len(chainID) == 0 && opType != 0x03 {
+		log.Fatalf("--chain-id is required for op type %v\n", opType)
+	}
+}
+
+// currentLevel of a single watermark entry, or "none" if it does not exist
+func currentLevel(admin watermark.Admin, keyHash string, chainID string, opType uint) string {
+	entries, err := admin.Entries()
+	if err != nil {
+		log.Fatal("Unable to list watermark entries: ", err)
+	}
+	for _, entry := range entries {
+		if entry.KeyHash == keyHash && entry.ChainID == chainID && entry.OpType == fmt.Sprint(opType) {
+			return entry.Level
+		}
+	}
+	return "none"
+}
+
+// confirm an action on stdin unless --yes was provided
+func confirm(yes bool, question string) {
+	if yes {
+		return
+	}
+	fmt.Printf("%v [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		log.Fatal("Aborted")
+	}
+}
@@ -0,0 +1,418 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Statuses of pending requests
+const (
+	PendingStatusPending   = "pending"
+	PendingStatusSigning   = "signing"
+	PendingStatusSigned    = "signed"
+	PendingStatusRejected  = "rejected"
+	PendingStatusExpired   = "expired"
+	PendingStatusFailed    = "failed"
+	PendingStatusCancelled = "cancelled"
+)
+
+// pendingRetention of finished requests after they expire
+const pendingRetention = 24 * time.Hour
+
+// ApprovalPolicy holds generic operations worth more than the threshold,
+// in XTZ, until Required of the approvers approve them and the Delay has
+// passed.  Any approver can reject them, and operators with the AdminToken
+// can cancel them.  Either Required or Delay must be set.
+type ApprovalPolicy struct {
+	Threshold  string        `yaml:"Threshold"`
+	Required   int           `yaml:"Required"`
+	Delay      time.Duration `yaml:"Delay"`
+	Expiry     time.Duration `yaml:"Expiry"`
+	Approvers  []*Approver   `yaml:"Approvers"`
+	AdminToken string        `yaml:"AdminToken"`
+	NotifyURL  string        `yaml:"NotifyURL"`
+
+	// Threshold in uXTZ
+	threshold *big.Int
+}
+
+// Approver of pending requests, authenticated by their Tezos key
+type Approver struct {
+	Name      string `yaml:"Name"`
+	PublicKey string `yaml:"PublicKey"`
+
+	publicKeyHash string
+}
+
+// PendingRequest to sign an operation once it's approved
+type PendingRequest struct {
+	ID         string     `json:"id"`
+	Key        string     `json:"key"`
+	Operation  string     `json:"operation"`
+	Value      *big.Int   `json:"value"`
+	Status     string     `json:"status"`
+	Created    time.Time  `json:"created"`
+	Unlocks    time.Time  `json:"unlocks"`
+	Expires    time.Time  `json:"expires"`
+	Approvals  []string   `json:"approvals"`
+	RejectedBy string     `json:"rejected_by,omitempty"`
+	Signature  string     `json:"signature,omitempty"`
+	Failure    *SignError `json:"failure,omitempty"`
+}
+
+// ApprovalQueue of requests waiting for approval, persisted in a file if set
+type ApprovalQueue struct {
+	policy   *ApprovalPolicy
+	file     string
+	requests map[string]*PendingRequest
+	mux      sync.Mutex
+}
+
+// LoadApprovalFile loads the approval policy from a file
+func LoadApprovalFile(file string) *ApprovalPolicy {
+	policy := &ApprovalPolicy{}
+
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln("Unable to read file: " + file)
+	}
+	err = yaml.Unmarshal(yamlFile, policy)
+	if err != nil {
+		log.Fatalln("Unable to parse yaml file: " + file)
+	}
+	if err := policy.parse(); err != nil {
+		log.Fatalf("Invalid approval policy %v: %v\n", file, err)
+	}
+	return policy
+}
+
+// parse the threshold and approver keys of the policy
+func (policy *ApprovalPolicy) parse() error {
+	var err error
+	if policy.threshold, err = ParseTez(policy.Threshold); err != nil {
+		return fmt.Errorf("invalid Threshold: %v", err)
+	}
+	if policy.threshold == nil {
+		return fmt.Errorf("a Threshold is required")
+	}
+	if policy.Required < 0 || policy.Required > len(policy.Approvers) {
+		return fmt.Errorf("Required must be between 0 and the %v approvers", len(policy.Approvers))
+	}
+	if policy.Required == 0 && policy.Delay <= 0 {
+		return fmt.Errorf("Required approvers or a Delay must be set")
+	}
+	if policy.Expiry <= 0 {
+		policy.Expiry = policy.Delay + time.Hour
+	}
+	if policy.Expiry <= policy.Delay {
+		return fmt.Errorf("Expiry must be longer than the Delay")
+	}
+	for _, approver := range policy.Approvers {
+		if approver.publicKeyHash, err = PublicKeyHash(approver.PublicKey); err != nil {
+			return fmt.Errorf("approver %v: %v", approver.Name, err)
+		}
+	}
+	return nil
+}
+
+// NewApprovalQueue of requests held by the policy, in memory
+func NewApprovalQueue(policy *ApprovalPolicy) *ApprovalQueue {
+	return &ApprovalQueue{
+		policy:   policy,
+		requests: map[string]*PendingRequest{},
+		mux:      sync.Mutex{},
+	}
+}
+
+// LoadApprovalQueue of requests held by the policy, persisted in the file so
+// they survive restarts.  Requests that were being signed are failed.
+func LoadApprovalQueue(policy *ApprovalPolicy, file string) *ApprovalQueue {
+	// If file is not set, create a new file in our home directory
+	if len(file) == 0 {
+		file = path.Join(os.Getenv("HOME"), ".hsm-signer-pending")
+	}
+	queue := NewApprovalQueue(policy)
+	queue.file = file
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		log.Println("Pending file did not exist.  Initializing: ", file)
+	} else {
+		jsonFile, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal("Unable to read pending file: ", file)
+		}
+		requests := []*PendingRequest{}
+		if err = json.Unmarshal(jsonFile, &requests); err != nil {
+			log.Fatal("Unable to parse pending file: ", file)
+		}
+		for _, request := range requests {
+			if request.Status == PendingStatusSigning {
+				request.Status = PendingStatusFailed
+				request.Failure = signError(http.StatusInternalServerError, ReasonBackendError, "interrupted while signing")
+			}
+			queue.requests[request.ID] = request
+		}
+	}
+	// Verify we can write to disk before returning
+	if queue.saveToDisk() != nil {
+		log.Fatal("Could not write to pending file")
+	}
+	return queue
+}
+
+// saveToDisk the requests, dropping those that expired long ago.  The
+// caller holds the lock.
+func (queue *ApprovalQueue) saveToDisk() error {
+	if len(queue.file) == 0 {
+		return nil
+	}
+	requests := []*PendingRequest{}
+	for id, request := range queue.requests {
+		if time.Since(request.Expires) > pendingRetention {
+			delete(queue.requests, id)
+			continue
+		}
+		requests = append(requests, request)
+	}
+	data, err := json.Marshal(requests)
+	if err != nil {
+		log.Println("Unable to marshall pending requests")
+		return err
+	}
+	err = ioutil.WriteFile(queue.file, data, 0600)
+	if err != nil {
+		log.Println("Unable to write pending file: " + queue.file)
+		return err
+	}
+	return nil
+}
+
+// needsApproval if the operation is worth more than the threshold, storage
+// costing costPerByte.  Operations whose value can't be computed are held.
+func (queue *ApprovalQueue) needsApproval(op *Operation, costPerByte *big.Int) (*big.Int, bool) {
+	if op.MagicByte() != opMagicByteGeneric {
+		return nil, false
+	}
+	value := GetGenericOperation(op).valueAt(costPerByte)
+	return value, value == nil || value.Cmp(queue.policy.threshold) > 0
+}
+
+// hold the request until it's approved, returning a copy
+func (queue *ApprovalQueue) hold(key *Key, body []byte, value *big.Int) *PendingRequest {
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now()
+	request := &PendingRequest{
+		ID:        hex.EncodeToString(id),
+		Key:       key.PublicKeyHash,
+		Operation: string(body),
+		Value:     value,
+		Status:    PendingStatusPending,
+		Created:   now,
+		Unlocks:   now.Add(queue.policy.Delay),
+		Expires:   now.Add(queue.policy.Expiry),
+		Approvals: []string{},
+	}
+
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+	queue.requests[request.ID] = request
+	queue.saveToDisk()
+
+	log.Printf("[WARN] Request %v to sign %v uXTZ with %v is held for %v approvals until at least %v.  Cancel it with POST /pending/%v/cancel\n",
+		request.ID, value, key.PublicKeyHash, queue.policy.Required, request.Unlocks.Format(time.RFC3339), request.ID)
+	copied := *request
+	go queue.notify(&copied)
+	return &copied
+}
+
+// notify operators of a held request, if a URL is set
+func (queue *ApprovalQueue) notify(request *PendingRequest) {
+	if len(queue.policy.NotifyURL) == 0 {
+		return
+	}
+	body, _ := json.Marshal(request)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(queue.policy.NotifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[ERROR] Unable to notify operators of request %v: %v\n", request.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[ERROR] Unable to notify operators of request %v: status %v\n", request.ID, resp.StatusCode)
+	}
+}
+
+// get a copy of the request, or nil if there's none with the ID
+func (queue *ApprovalQueue) get(id string) *PendingRequest {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	request, ok := queue.requests[id]
+	if !ok {
+		return nil
+	}
+	queue.expire(request)
+	copied := *request
+	return &copied
+}
+
+// list copies of every request, oldest first
+func (queue *ApprovalQueue) list() []*PendingRequest {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	requests := []*PendingRequest{}
+	for _, request := range queue.requests {
+		queue.expire(request)
+		copied := *request
+		requests = append(requests, &copied)
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Created.Before(requests[j].Created) })
+	return requests
+}
+
+// expire the request if it's still pending.  The caller holds the lock.
+func (queue *ApprovalQueue) expire(request *PendingRequest) {
+	if request.Status == PendingStatusPending && time.Now().After(request.Expires) {
+		request.Status = PendingStatusExpired
+		queue.saveToDisk()
+	}
+}
+
+// claimIfReady once enough approvers agree and the delay has passed, moving
+// the request to signing.  Only the caller that claims it may sign it.  The
+// caller holds the lock.
+func (queue *ApprovalQueue) claimIfReady(request *PendingRequest) bool {
+	if request.Status == PendingStatusPending && len(request.Approvals) >= queue.policy.Required && !time.Now().Before(request.Unlocks) {
+		request.Status = PendingStatusSigning
+		return true
+	}
+	return false
+}
+
+// unlock the request once it's ready, returning a copy and whether the
+// caller claimed it to sign
+func (queue *ApprovalQueue) unlock(id string) (*PendingRequest, bool) {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	request, ok := queue.requests[id]
+	if !ok {
+		return nil, false
+	}
+	queue.expire(request)
+	claimed := queue.claimIfReady(request)
+	queue.saveToDisk()
+	copied := *request
+	return &copied, claimed
+}
+
+// cancel the request with the admin token
+func (queue *ApprovalQueue) cancel(id string, token string) (*PendingRequest, *SignError) {
+	if len(queue.policy.AdminToken) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(queue.policy.AdminToken)) != 1 {
+		return nil, signError(http.StatusForbidden, ReasonUnauthorized, "invalid admin token")
+	}
+
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	request, ok := queue.requests[id]
+	if !ok {
+		return nil, signError(http.StatusNotFound, ReasonNotFound, "no pending request "+id)
+	}
+	queue.expire(request)
+	if request.Status != PendingStatusPending {
+		return nil, signError(http.StatusConflict, ReasonBadRequest, "request is "+request.Status)
+	}
+	request.Status = PendingStatusCancelled
+	queue.saveToDisk()
+	log.Printf("[INFO] Request %v is cancelled\n", id)
+	copied := *request
+	return &copied, nil
+}
+
+// approvalMessage an approver signs to approve or reject the request
+func approvalMessage(approve bool, id string) []byte {
+	if approve {
+		return []byte("approve " + id)
+	}
+	return []byte("reject " + id)
+}
+
+// vote to approve or reject the request, signed by an approver.  Returns a
+// copy of the request and whether this vote claimed it to sign, once enough
+// approvers agree.
+func (queue *ApprovalQueue) vote(id string, approverHash string, signature string, approve bool) (*PendingRequest, bool, *SignError) {
+	var approver *Approver
+	for _, a := range queue.policy.Approvers {
+		if a.publicKeyHash == approverHash || a.Name == approverHash {
+			approver = a
+		}
+	}
+	if approver == nil {
+		return nil, false, signError(http.StatusForbidden, ReasonUnauthorized, "unknown approver "+approverHash)
+	}
+	if err := VerifySignature(approver.PublicKey, approvalMessage(approve, id), signature); err != nil {
+		return nil, false, signError(http.StatusForbidden, ReasonUnauthorized, err.Error())
+	}
+
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	request, ok := queue.requests[id]
+	if !ok {
+		return nil, false, signError(http.StatusNotFound, ReasonNotFound, "no pending request "+id)
+	}
+	queue.expire(request)
+	if request.Status != PendingStatusPending {
+		return nil, false, signError(http.StatusConflict, ReasonBadRequest, "request is "+request.Status)
+	}
+	claimed := false
+	if !approve {
+		request.Status = PendingStatusRejected
+		request.RejectedBy = approver.Name
+	} else if !containsString(request.Approvals, approver.Name) {
+		request.Approvals = append(request.Approvals, approver.Name)
+		claimed = queue.claimIfReady(request)
+	}
+	queue.saveToDisk()
+	log.Printf("[INFO] Request %v is %v with %v of %v approvals\n", id, request.Status, len(request.Approvals), queue.policy.Required)
+	copied := *request
+	return &copied, claimed, nil
+}
+
+// finish a claimed request with its signature, or why it wasn't signed
+func (queue *ApprovalQueue) finish(id string, signature string, failure *SignError) *PendingRequest {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	request := queue.requests[id]
+	if request.Status != PendingStatusSigning {
+		log.Printf("[ERROR] Request %v is %v rather than signing.  Keeping it as it is\n", id, request.Status)
+	} else if failure != nil {
+		request.Status = PendingStatusFailed
+		request.Failure = failure
+	} else {
+		request.Status = PendingStatusSigned
+		request.Signature = signature
+	}
+	queue.saveToDisk()
+	copied := *request
+	return &copied
+}
@@ -0,0 +1,295 @@
+package signer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testApprover struct {
+	pkh  string
+	sign func(message []byte) string
+}
+
+// testApprovalServer holding transfers over 1 XTZ until 2 of 3 approve
+func testApprovalServer(t *testing.T) (*Server, []*testApprover) {
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.filter.EnableTx = true
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	server.signer = &testSigner{SignedBytes: signedBytes}
+
+	policy := &ApprovalPolicy{Threshold: "1", Required: 2}
+	approvers := []*testApprover{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		publicKey, sign := testKeyPair(t, curveEd25519)
+		pkh, _ := PublicKeyHash(publicKey)
+		policy.Approvers = append(policy.Approvers, &Approver{Name: name, PublicKey: publicKey})
+		approvers = append(approvers, &testApprover{pkh: pkh, sign: sign})
+	}
+	if err := policy.parse(); err != nil {
+		log.Println("[Approval Test] Invalid policy:", err)
+		t.FailNow()
+	}
+	server.SetApprovalQueue(NewApprovalQueue(policy))
+	return server, approvers
+}
+
+// testPending requests a /pending route, decoding the response into v
+func testPending(server *Server, method string, path string, body string, v interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	Middleware(server.RoutePending)(w, r)
+	resp := w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(respBody, v)
+	return resp.StatusCode
+}
+
+// testVote of the approver, signing the message for the ID
+func testVote(server *Server, approver *testApprover, action string, id string, signedID string) (int, *PendingRequest) {
+	body := fmt.Sprintf("{\"approver\":%q,\"signature\":%q}", approver.pkh, approver.sign([]byte(action+" "+signedID)))
+	request := &PendingRequest{}
+	status := testPending(server, "POST", "/pending/"+id+"/"+action, body, request)
+	return status, request
+}
+
+// testHold posts the transfer, returning the ID of the pending request
+func testHold(t *testing.T, server *Server) string {
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	pending := &SignError{}
+	json.Unmarshal([]byte(body), pending)
+	if resp.StatusCode != http.StatusAccepted || pending.Code != ReasonPending || len(pending.ID) == 0 {
+		log.Printf("[Approval Test] Expected the transfer to be held.  Received %v %v\n", resp.StatusCode, body)
+		t.FailNow()
+	}
+	return pending.ID
+}
+
+func TestApprovalQueue(t *testing.T) {
+	server, approvers := testApprovalServer(t)
+	id := testHold(t, server)
+
+	request := &PendingRequest{}
+	if status := testPending(server, "GET", "/pending/"+id, "", request); status != http.StatusOK || request.Status != PendingStatusPending {
+		log.Printf("[Approval Test] Expected the request to be pending.  Received %v %+v\n", status, request)
+		t.Fail()
+	}
+	if status, _ := testVote(server, approvers[0], "approve", id, "other"); status != http.StatusForbidden {
+		log.Printf("[Approval Test] Expected a signature of another ID to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+	stranger := &testApprover{pkh: "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx", sign: approvers[0].sign}
+	if status, _ := testVote(server, stranger, "approve", id, id); status != http.StatusForbidden {
+		log.Printf("[Approval Test] Expected an unknown approver to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+
+	// Approving twice counts once
+	testVote(server, approvers[0], "approve", id, id)
+	if _, request = testVote(server, approvers[0], "approve", id, id); request.Status != PendingStatusPending || len(request.Approvals) != 1 {
+		log.Printf("[Approval Test] Expected one approval.  Received %+v\n", request)
+		t.Fail()
+	}
+	if _, request = testVote(server, approvers[1], "approve", id, id); request.Status != PendingStatusSigned {
+		log.Printf("[Approval Test] Expected the second approval to sign.  Received %+v\n", request)
+		t.Fail()
+	}
+	request = &PendingRequest{}
+	testPending(server, "GET", "/pending/"+id, "", request)
+	if "{\"signature\":\""+request.Signature+"\"}" != testSecp256k1Tx.SignerResponse {
+		log.Printf("[Approval Test] Expected polling to return the signature.  Received %+v\n", request)
+		t.Fail()
+	}
+	if status, _ := testVote(server, approvers[2], "approve", id, id); status != http.StatusConflict {
+		log.Printf("[Approval Test] Expected votes on a signed request to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+}
+
+func TestApprovalRejectAndExpire(t *testing.T) {
+	server, approvers := testApprovalServer(t)
+
+	id := testHold(t, server)
+	testVote(server, approvers[0], "approve", id, id)
+	if _, request := testVote(server, approvers[2], "reject", id, id); request.Status != PendingStatusRejected || request.RejectedBy != "carol" {
+		log.Printf("[Approval Test] Expected carol to reject the request.  Received %+v\n", request)
+		t.Fail()
+	}
+	if status, _ := testVote(server, approvers[1], "approve", id, id); status != http.StatusConflict {
+		log.Printf("[Approval Test] Expected approving a rejected request to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+
+	server.approvals.policy.Expiry = time.Nanosecond
+	id = testHold(t, server)
+	time.Sleep(time.Millisecond)
+	requests := []*PendingRequest{}
+	testPending(server, "GET", "/pending", "", &requests)
+	if len(requests) != 2 || requests[1].ID != id || requests[1].Status != PendingStatusExpired {
+		log.Printf("[Approval Test] Expected the second request to expire.  Received %+v\n", requests)
+		t.Fail()
+	}
+}
+
+func TestApprovalUnderThreshold(t *testing.T) {
+	server, _ := testApprovalServer(t)
+	server.approvals.policy.threshold.SetInt64(2000000)
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	compare(t, "Under Approval Threshold", resp.StatusCode, http.StatusOK, body, testSecp256k1Tx.SignerResponse)
+}
+
+func TestApprovalValue(t *testing.T) {
+	server, _ := testApprovalServer(t)
+	op, _ := ParseOperation([]byte(testPolicyTransfer(false, 1000000, 1000)))
+	value, _ := server.approvals.needsApproval(op, big.NewInt(0))
+	server.approvals.policy.threshold.Set(value)
+	if _, held := server.approvals.needsApproval(op, big.NewInt(0)); held {
+		log.Println("[Approval Test] A transfer at the threshold should not be held")
+		t.Fail()
+	}
+	// Storage is priced like --cost-per-byte
+	if _, held := server.approvals.needsApproval(op, big.NewInt(1)); !held {
+		log.Println("[Approval Test] A transfer over the threshold with storage costs should be held")
+		t.Fail()
+	}
+	// Batches whose value is unknown are held
+	op, _ = ParseOperation([]byte(testBakerOperation("cc", "00")))
+	if _, held := server.approvals.needsApproval(op, big.NewInt(0)); !held {
+		log.Println("[Approval Test] An undecodable batch should be held")
+		t.Fail()
+	}
+}
+
+func TestTimeLock(t *testing.T) {
+	server, _ := testApprovalServer(t)
+	policy := &ApprovalPolicy{Threshold: "1", Delay: 50 * time.Millisecond, AdminToken: "secret"}
+	if err := policy.parse(); err != nil {
+		log.Println("[Time Lock Test] Invalid policy:", err)
+		t.FailNow()
+	}
+	server.SetApprovalQueue(NewApprovalQueue(policy))
+
+	id := testHold(t, server)
+	request := &PendingRequest{}
+	if testPending(server, "GET", "/pending/"+id, "", request); request.Status != PendingStatusPending {
+		log.Printf("[Time Lock Test] Expected the request to be locked.  Received %+v\n", request)
+		t.Fail()
+	}
+
+	// Cancelling takes the admin token
+	cancelled := testHold(t, server)
+	r := httptest.NewRequest("POST", "/pending/"+cancelled+"/cancel", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	Middleware(server.RoutePending)(w, r)
+	if w.Result().StatusCode != http.StatusForbidden {
+		log.Printf("[Time Lock Test] Expected a wrong admin token to be refused.  Received %v\n", w.Result().StatusCode)
+		t.Fail()
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	Middleware(server.RoutePending)(w, r)
+	if w.Result().StatusCode != http.StatusOK {
+		log.Printf("[Time Lock Test] Expected the admin token to cancel.  Received %v\n", w.Result().StatusCode)
+		t.Fail()
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	request = &PendingRequest{}
+	testPending(server, "GET", "/pending/"+id, "", request)
+	if request.Status != PendingStatusSigned || "{\"signature\":\""+request.Signature+"\"}" != testSecp256k1Tx.SignerResponse {
+		log.Printf("[Time Lock Test] Expected polling after the delay to sign.  Received %+v\n", request)
+		t.Fail()
+	}
+	request = &PendingRequest{}
+	testPending(server, "GET", "/pending/"+cancelled, "", request)
+	if request.Status != PendingStatusCancelled {
+		log.Printf("[Time Lock Test] Expected the cancelled request to stay cancelled.  Received %+v\n", request)
+		t.Fail()
+	}
+}
+
+func TestApprovalQueuePersistence(t *testing.T) {
+	file := t.TempDir() + "/pending"
+	policy := &ApprovalPolicy{Threshold: "1", Delay: time.Hour}
+	policy.parse()
+	key := &Key{PublicKeyHash: testSecp256k1Tx.PublicKeyHash}
+
+	queue := LoadApprovalQueue(policy, file)
+	held := queue.hold(key, []byte(testSecp256k1Tx.Operation), big.NewInt(5000000))
+	signing := queue.hold(key, []byte(testSecp256k1Tx.Operation), big.NewInt(5000000))
+	queue.requests[signing.ID].Status = PendingStatusSigning
+	queue.saveToDisk()
+
+	queue = LoadApprovalQueue(policy, file)
+	if request := queue.get(held.ID); request == nil || request.Status != PendingStatusPending || request.Operation != testSecp256k1Tx.Operation {
+		log.Printf("[Approval Persistence Test] Expected the held request to be reloaded.  Received %+v\n", request)
+		t.Fail()
+	}
+	if request := queue.get(signing.ID); request == nil || request.Status != PendingStatusFailed {
+		log.Printf("[Approval Persistence Test] Expected the request being signed to fail.  Received %+v\n", request)
+		t.Fail()
+	}
+}
+
+// countingSigner counts the operations it signs
+type countingSigner struct {
+	testSigner
+	calls int32
+}
+
+func (signer *countingSigner) Sign(ctx context.Context, message []byte, key *Key) ([]byte, error) {
+	atomic.AddInt32(&signer.calls, 1)
+	return signer.testSigner.Sign(ctx, message, key)
+}
+
+func TestApprovalSignedOnce(t *testing.T) {
+	server, _ := testApprovalServer(t)
+	policy := &ApprovalPolicy{Threshold: "1", Delay: 10 * time.Millisecond}
+	policy.parse()
+	server.SetApprovalQueue(NewApprovalQueue(policy))
+	id := testHold(t, server)
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	signer := &countingSigner{testSigner: testSigner{SignedBytes: signedBytes}}
+	server.signer = signer
+
+	// Concurrent polls after the delay sign the request once
+	time.Sleep(20 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testPending(server, "GET", "/pending/"+id, "", &PendingRequest{})
+		}()
+	}
+	wg.Wait()
+	request := &PendingRequest{}
+	testPending(server, "GET", "/pending/"+id, "", request)
+	if calls := atomic.LoadInt32(&signer.calls); calls != 1 || request.Status != PendingStatusSigned {
+		log.Printf("[Approval Test] Expected the request to be signed once.  Signed %v times, %+v\n", calls, request)
+		t.Fail()
+	}
+
+	// Requests whose key was removed fail
+	id = testHold(t, server)
+	server.keys[0].PublicKeyHash = "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx"
+	time.Sleep(20 * time.Millisecond)
+	request = &PendingRequest{}
+	testPending(server, "GET", "/pending/"+id, "", request)
+	if request.Status != PendingStatusFailed || request.Failure == nil || request.Failure.Code != ReasonKeyNotFound {
+		log.Printf("[Approval Test] Expected a request of a removed key to fail.  Received %+v\n", request)
+		t.Fail()
+	}
+}
@@ -0,0 +1,68 @@
+package signer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AuthorizedKey of a client allowed to request signatures, as in the
+// authorized_keys of tezos-client signers
+type AuthorizedKey struct {
+	Name      string `yaml:"Name"`
+	PublicKey string `yaml:"PublicKey"`
+
+	publicKeyHash string
+}
+
+// LoadAuthorizedKeysFile loads the keys that authenticate sign requests
+func LoadAuthorizedKeysFile(file string) []*AuthorizedKey {
+	keys := []*AuthorizedKey{}
+
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln("Unable to read file: " + file)
+	}
+	err = yaml.Unmarshal(yamlFile, &keys)
+	if err != nil {
+		log.Fatalln("Unable to parse yaml file: " + file)
+	}
+	for _, key := range keys {
+		if key.publicKeyHash, err = PublicKeyHash(key.PublicKey); err != nil {
+			log.Fatalf("Invalid authorized key %v: %v\n", key.Name, err)
+		}
+	}
+	return keys
+}
+
+// authenticationMessage a client signs to request a signature of the data
+// by the key: 0x04, the tagged public key hash of the key, then the data
+func authenticationMessage(key *Key, data []byte) ([]byte, error) {
+	pkh, err := hex.DecodeString(PubkeyHashToByteString(key.PublicKeyHash))
+	if err != nil || len(pkh) != 21 {
+		return nil, fmt.Errorf("unable to encode %v", key.PublicKeyHash)
+	}
+	message := append([]byte{0x04}, pkh...)
+	return append(message, data...), nil
+}
+
+// authenticate the request to sign the data with the key by a signature of
+// any authorized key, returning its name
+func authenticate(authorizedKeys []*AuthorizedKey, key *Key, data []byte, signature string) (string, error) {
+	if len(signature) == 0 {
+		return "", fmt.Errorf("missing authentication")
+	}
+	message, err := authenticationMessage(key, data)
+	if err != nil {
+		return "", err
+	}
+	for _, authorized := range authorizedKeys {
+		if VerifySignature(authorized.PublicKey, message, signature) == nil {
+			return authorized.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no authorized key signed the request")
+}
@@ -0,0 +1,112 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testAuthenticatedPost posts the transfer with the authentication signature
+func testAuthenticatedPost(server *Server, signature string) (int, *SignError) {
+	path := fmt.Sprintf("/keys/%v?authentication=%v", testSecp256k1Tx.PublicKeyHash, url.QueryEscape(signature))
+	r := httptest.NewRequest("POST", path, bytes.NewReader([]byte(testSecp256k1Tx.Operation)))
+	w := httptest.NewRecorder()
+	Middleware(server.RouteKeys)(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	signErr := &SignError{}
+	json.Unmarshal(body, signErr)
+	return resp.StatusCode, signErr
+}
+
+func TestRequireAuthentication(t *testing.T) {
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.filter.EnableTx = true
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	server.signer = &testSigner{SignedBytes: signedBytes}
+
+	publicKey, sign := testKeyPair(t, curveEd25519)
+	pkh, _ := PublicKeyHash(publicKey)
+	_, other := testKeyPair(t, curveEd25519)
+	server.RequireAuthentication([]*AuthorizedKey{&AuthorizedKey{Name: "client", PublicKey: publicKey, publicKeyHash: pkh}})
+
+	op, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+	message, err := authenticationMessage(&server.keys[0], op.Hex())
+	if err != nil || len(message) != 22+len(op.Hex()) || message[0] != 0x04 {
+		log.Printf("[Authentication Test] Expected 0x04, the key hash and the operation.  Received %x: %v\n", message, err)
+		t.FailNow()
+	}
+
+	if status, signErr := testAuthenticatedPost(server, ""); status != http.StatusForbidden || signErr.Code != ReasonUnauthorized {
+		log.Printf("[Authentication Test] Expected a request without authentication to be refused.  Received %v %+v\n", status, signErr)
+		t.Fail()
+	}
+	if status, signErr := testAuthenticatedPost(server, other(message)); status != http.StatusForbidden || signErr.Code != ReasonUnauthorized {
+		log.Printf("[Authentication Test] Expected an unknown key's authentication to be refused.  Received %v %+v\n", status, signErr)
+		t.Fail()
+	}
+	if status, signErr := testAuthenticatedPost(server, sign(append(message, 0x00))); status != http.StatusForbidden {
+		log.Printf("[Authentication Test] Expected authentication of other data to be refused.  Received %v %+v\n", status, signErr)
+		t.Fail()
+	}
+	if status, signErr := testAuthenticatedPost(server, sign(message)); status != http.StatusOK {
+		log.Printf("[Authentication Test] Expected an authenticated request to be signed.  Received %v %+v\n", status, signErr)
+		t.Fail()
+	}
+
+	r := httptest.NewRequest("GET", "/authorized_keys", nil)
+	w := httptest.NewRecorder()
+	Middleware(server.RouteAuthorizedKeys)(w, r)
+	listed := map[string][]string{}
+	json.NewDecoder(w.Result().Body).Decode(&listed)
+	if len(listed["authorized_keys"]) != 1 || listed["authorized_keys"][0] != pkh {
+		log.Printf("[Authentication Test] Expected %v to be listed.  Received %v\n", pkh, listed)
+		t.Fail()
+	}
+}
+
+func TestPendingAuthentication(t *testing.T) {
+	server, approvers := testApprovalServer(t)
+	id := testHold(t, server)
+
+	publicKey, sign := testKeyPair(t, curveEd25519)
+	pkh, _ := PublicKeyHash(publicKey)
+	server.RequireAuthentication([]*AuthorizedKey{&AuthorizedKey{Name: "client", PublicKey: publicKey, publicKeyHash: pkh}})
+	op, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+	message, _ := authenticationMessage(&server.keys[0], op.Hex())
+	authentication := "?authentication=" + url.QueryEscape(sign(message))
+
+	if listed := []*PendingRequest{}; testPending(server, "GET", "/pending", "", &listed) != http.StatusOK || len(listed) != 1 {
+		log.Printf("[Authentication Test] Expected approvers to list the request.  Received %v\n", listed)
+		t.Fail()
+	}
+	if status := testPending(server, "GET", "/pending/"+id, "", &PendingRequest{}); status != http.StatusForbidden {
+		log.Printf("[Authentication Test] Expected an unauthenticated poll to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+	// Approvers vote with their own keys
+	if status, request := testVote(server, approvers[0], "approve", id, id); status != http.StatusOK || len(request.Approvals) != 1 {
+		log.Printf("[Authentication Test] Expected an approver's vote to count.  Received %v %+v\n", status, request)
+		t.Fail()
+	}
+	request := &PendingRequest{}
+	if status := testPending(server, "GET", "/pending/"+id+authentication, "", request); status != http.StatusOK || request.Status != PendingStatusPending {
+		log.Printf("[Authentication Test] Expected an authenticated poll.  Received %v %+v\n", status, request)
+		t.Fail()
+	}
+
+	describe := "/describe?key=" + testSecp256k1Tx.PublicKeyHash
+	for path, expected := range map[string]int{"/describe": http.StatusForbidden, describe: http.StatusForbidden, describe + "&" + authentication[1:]: http.StatusOK} {
+		if resp, _ := testDescribePath(t, server, path, testSecp256k1Tx.Operation); resp.StatusCode != expected {
+			log.Printf("[Authentication Test] Expected %v to return %v.  Received %v\n", path, expected, resp.StatusCode)
+			t.Fail()
+		}
+	}
+}
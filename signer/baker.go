@@ -0,0 +1,54 @@
+package signer
+
+// evaluateBakerParameters of reveals, delegations and the operations of a
+// baker's payout and consensus key workflows.  Returns nil for other kinds.
+// Checks against the signing key are skipped when it isn't known.
+func (filter *OperationFilter) evaluateBakerParameters(subject string, content OperationContent, key *Key) *FilterDecision {
+	switch c := content.(type) {
+	case *Reveal:
+		if key != nil && len(key.PublicKey) > 0 && c.PublicKey != key.PublicKey {
+			return deny("enable-reveal", subject, "reveal of "+c.PublicKey+" isn't the signing key")
+		}
+		return allow("enable-reveal", subject, "reveal of the signing key")
+	case *Delegation:
+		if filter.DelegationBakers == nil {
+			return allow("delegation-bakers", subject, "no baker list is set")
+		}
+		if len(c.Delegate) == 0 {
+			return deny("delegation-bakers", subject, "withdrawing the delegation is not allowed with a baker list")
+		}
+		if !containsString(filter.DelegationBakers, c.Delegate) {
+			return deny("delegation-bakers", subject, c.Delegate+" is not an allowed baker")
+		}
+		return allow("delegation-bakers", subject, c.Delegate+" is an allowed baker")
+	case *SetDepositsLimit:
+		return evaluateBakerSource("enable-set-deposits-limit", subject, c.Source, key)
+	case *UpdateConsensusKey:
+		if decision := evaluateBakerSource("enable-update-consensus-key", subject, c.Source, key); !decision.Allowed {
+			return decision
+		}
+		if filter.ConsensusKeys != nil && !containsString(filter.ConsensusKeys, c.PublicKey) {
+			return deny("consensus-keys", subject, c.PublicKey+" is not an allowed consensus key")
+		}
+		return allow("consensus-keys", subject, "the consensus key is allowed")
+	case *DrainDelegate:
+		if key != nil && c.ConsensusKey != key.PublicKeyHash {
+			return deny("enable-drain-delegate", subject, "drain is not signed by the consensus key "+c.ConsensusKey)
+		}
+		if filter.DrainDestinations != nil && !containsString(filter.DrainDestinations, c.Destination) {
+			return deny("drain-destinations", subject, c.Destination+" is not an allowed drain destination")
+		}
+		return allow("drain-destinations", subject, "the drain destination is allowed")
+	default:
+		return nil
+	}
+}
+
+// evaluateBakerSource allows operations a baker makes for itself, signed by
+// the key of their source
+func evaluateBakerSource(rule string, subject string, source string, key *Key) *FilterDecision {
+	if key != nil && source != key.PublicKeyHash {
+		return deny(rule, subject, "source "+source+" isn't the signing key")
+	}
+	return allow(rule, subject, "source is the signing key")
+}
@@ -0,0 +1,125 @@
+package signer
+
+import (
+	"log"
+	"strings"
+	"testing"
+)
+
+const (
+	testBakerSource = "0154f5d8f71ce18f9f05bb885a4120e64c667bc1b4"
+	testBakerTz1    = "008c947bf65254cf1a813eb8c6d3f980a89751e2af"
+	testBakerTz3    = "02a88430950b81e860bc6d7cec866864e46a667819"
+)
+
+// testBakerOperation forges a manager operation of tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m
+func testBakerOperation(tag string, body string) string {
+	return "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+		tag + testBakerSource + "01020304" + body + "\""
+}
+
+// testBakerReveal forges a reveal of a P-256 public key of repeated bytes
+func testBakerReveal(b string) string {
+	return testBakerOperation("6b", "02"+strings.Repeat(b, 33))
+}
+
+// testBakerDrain forges a drain of tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m by
+// its consensus key
+func testBakerDrain(consensusKey string, destination string) string {
+	return "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+		"09" + consensusKey + testBakerSource + destination + "\""
+}
+
+// testBakerPublicKey decoded from the only content of the operation
+func testBakerPublicKey(t *testing.T, operation string) string {
+	op, _ := ParseOperation([]byte(operation))
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil || len(contents) != 1 {
+		log.Printf("Unable to decode %v: %v\n", operation, err)
+		t.FailNow()
+	}
+	switch c := contents[0].(type) {
+	case *Reveal:
+		return c.PublicKey
+	case *UpdateConsensusKey:
+		return c.PublicKey
+	}
+	return ""
+}
+
+func TestBakerOperations(t *testing.T) {
+	reveal := testBakerReveal("11")
+	key := &Key{PublicKeyHash: "tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m", PublicKey: testBakerPublicKey(t, reveal)}
+	other := &Key{PublicKeyHash: "tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"}
+
+	disabled := &OperationFilter{}
+	testKeyPolicy(t, "[Baker Test - Reveal Disabled]", disabled, key, reveal, false)
+	testKeyPolicy(t, "[Baker Test - Delegation Disabled]", disabled, key, testPolicyDelegation(true), false)
+
+	filter := &OperationFilter{EnableReveal: true, EnableDelegation: true, EnableUpdateConsensusKey: true, EnableDrainDelegate: true}
+	tests := []struct {
+		Name      string
+		Key       *Key
+		Operation string
+		Expected  bool
+	}{
+		{"Reveal", key, reveal, true},
+		{"Reveal Other Key", key, testBakerReveal("22"), false},
+		{"Reveal Unknown Key", nil, testBakerReveal("22"), true},
+		{"Delegation", key, testPolicyDelegation(false), true},
+		{"Withdraw Delegation", key, testBakerOperation("6e", "00"), true},
+		{"Update Consensus Key", key, testBakerOperation("72", "02"+strings.Repeat("22", 33)), true},
+		{"Update Other's Consensus Key", other, testBakerOperation("72", "02"+strings.Repeat("22", 33)), false},
+		{"Drain", other, testBakerDrain(testBakerTz1, testBakerTz3), true},
+		{"Drain By Other Key", key, testBakerDrain(testBakerTz1, testBakerTz3), false},
+		{"Transfer", key, testPolicyTransfer(false, 1, 1), false},
+	}
+	for _, test := range tests {
+		testKeyPolicy(t, "[Baker Test - "+test.Name+"]", filter, test.Key, test.Operation, test.Expected)
+	}
+}
+
+func TestBakerLists(t *testing.T) {
+	update := testBakerOperation("72", "02"+strings.Repeat("22", 33))
+	filter := &OperationFilter{
+		EnableDelegation:         true,
+		EnableUpdateConsensusKey: true,
+		EnableDrainDelegate:      true,
+		DelegationBakers:         []string{testPolicyBaker},
+		ConsensusKeys:            []string{testBakerPublicKey(t, update)},
+		DrainDestinations:        []string{testPolicyCold},
+	}
+	key := &Key{PublicKeyHash: "tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m"}
+	consensus := &Key{PublicKeyHash: testPolicyBaker}
+
+	tests := []struct {
+		Name      string
+		Key       *Key
+		Operation string
+		Expected  bool
+	}{
+		{"Delegate To Baker", key, testPolicyDelegation(true), true},
+		{"Delegate Elsewhere", key, testPolicyDelegation(false), false},
+		{"Withdraw Delegation", key, testBakerOperation("6e", "00"), false},
+		{"Allowed Consensus Key", key, update, true},
+		{"Other Consensus Key", key, testBakerOperation("72", "02"+strings.Repeat("33", 33)), false},
+		{"Drain To Cold", consensus, testBakerDrain(testBakerTz1, testBakerTz3), true},
+		{"Drain Elsewhere", consensus, testBakerDrain(testBakerTz1, testBakerTz1), false},
+	}
+	for _, test := range tests {
+		testKeyPolicy(t, "[Baker List Test - "+test.Name+"]", filter, test.Key, test.Operation, test.Expected)
+	}
+}
+
+func TestBakerDepositsLimit(t *testing.T) {
+	// Deposits limits were removed in Oxford
+	defer SetProtocol(activeProtocol.Name)
+	SetProtocol("nairobi")
+
+	limit := testBakerOperation("70", "ff"+testZarith(1000000))
+	filter := &OperationFilter{EnableSetDepositsLimit: true}
+	testKeyPolicy(t, "[Baker Test - Deposits Limit Disabled]", &OperationFilter{}, nil, limit, false)
+	testKeyPolicy(t, "[Baker Test - Deposits Limit]", filter, &Key{PublicKeyHash: "tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m"}, limit, true)
+	testKeyPolicy(t, "[Baker Test - Remove Deposits Limit]", filter, nil, testBakerOperation("70", "00"), true)
+	testKeyPolicy(t, "[Baker Test - Other's Deposits Limit]", filter, &Key{PublicKeyHash: testPolicyBaker}, limit, false)
+}
@@ -0,0 +1,227 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Base58 prefixes of hashes found in block headers
+const (
+	tzOperationListListHash = "1d9f6d" // LLo(53)
+	tzContextHash           = "4fc7"   // Co(52)
+	tzBlockPayloadHash      = "016af2" // vh(52)
+	tzNonceHash             = "45dca9" // nce(53)
+)
+
+// BlockHeader of a block signing request
+// According to: https://gitlab.com/tezos/tezos/blob/master/src/lib_base/block_header.ml#L44
+type BlockHeader struct {
+	ChainID string `json:"chain_id"`
+
+	// Shell header, shared by every protocol
+	Level          int32      `json:"level"`
+	ProtoLevel     uint8      `json:"proto_level"`
+	Predecessor    string     `json:"predecessor"`
+	Timestamp      time.Time  `json:"timestamp"`
+	ValidationPass uint8      `json:"validation_pass"`
+	OperationsHash string     `json:"operations_hash"`
+	Fitness        []HexBytes `json:"fitness"`
+	Context        string     `json:"context"`
+
+	// Protocol data.  Emmy blocks have a priority, Tenderbake blocks a
+	// payload hash and round.
+	Priority            uint16   `json:"priority,omitempty"`
+	PayloadHash         string   `json:"payload_hash,omitempty"`
+	PayloadRound        int32    `json:"payload_round,omitempty"`
+	ProofOfWorkNonce    HexBytes `json:"proof_of_work_nonce"`
+	SeedNonceHash       string   `json:"seed_nonce_hash,omitempty"`
+	LiquidityBakingVote string   `json:"liquidity_baking_vote,omitempty"`
+
+	err error
+}
+
+// Liquidity baking votes
+const (
+	liquidityBakingOn   = "on"
+	liquidityBakingOff  = "off"
+	liquidityBakingPass = "pass"
+)
+
+// GetBlockHeader decodes the header of a block operation.  Protocol data
+// that can't be decoded is logged but only the shell header is required.
+func GetBlockHeader(op *Operation) *BlockHeader {
+	if op.MagicByte() != opMagicByteBlock && op.MagicByte() != opMagicByteTenderbakeBlock {
+		return nil
+	}
+	header := &BlockHeader{}
+	d := newDecoder(op.Hex()[1:])
+	if header.err = header.decodeShell(d); header.err != nil {
+		log.Println("[WARN] Unable to decode block header:", header.err)
+		return header
+	}
+	if err := header.decodeProtocolData(d, op.MagicByte()); err != nil {
+		log.Println("[WARN] Unable to decode block protocol data:", err)
+	}
+	return header
+}
+
+// Err decoding the shell header, if any
+func (header *BlockHeader) Err() error {
+	return header.err
+}
+
+// Round of a Tenderbake block, the last element of its fitness
+// According to: https://gitlab.com/tezos/tezos/blob/master/src/proto_alpha/lib_protocol/fitness_repr.ml
+func (header *BlockHeader) Round() (int32, error) {
+	if len(header.Fitness) != 5 || len(header.Fitness[0]) != 1 || header.Fitness[0][0] != 0x02 {
+		return 0, fmt.Errorf("block fitness is not a Tenderbake fitness")
+	}
+	round, err := newDecoder(header.Fitness[4]).readInt32()
+	if err == nil && round < 0 {
+		err = fmt.Errorf("invalid round %v", round)
+	}
+	return round, err
+}
+
+// decodeShell reads the chain ID and the shell header
+func (header *BlockHeader) decodeShell(d *decoder) error {
+	var err error
+	if header.ChainID, err = d.readHash(tzChainID, 4); err != nil {
+		return err
+	}
+	if header.Level, err = d.readInt32(); err != nil {
+		return err
+	}
+	if header.ProtoLevel, err = d.readUint8(); err != nil {
+		return err
+	}
+	if header.Predecessor, err = d.readHash(tzBlockHash, 32); err != nil {
+		return err
+	}
+	timestamp, err := d.readInt64()
+	if err != nil {
+		return err
+	}
+	header.Timestamp = time.Unix(timestamp, 0).UTC()
+	if header.ValidationPass, err = d.readUint8(); err != nil {
+		return err
+	}
+	if header.OperationsHash, err = d.readHash(tzOperationListListHash, 32); err != nil {
+		return err
+	}
+	fitness, err := d.readVariableBytes()
+	if err != nil {
+		return fmt.Errorf("invalid block fitness: %w", err)
+	}
+	fd := newDecoder(fitness)
+	header.Fitness = []HexBytes{}
+	for fd.remaining() > 0 {
+		element, err := fd.readVariableBytes()
+		if err != nil {
+			return fmt.Errorf("invalid block fitness: %w", err)
+		}
+		header.Fitness = append(header.Fitness, element)
+	}
+	header.Context, err = d.readHash(tzContextHash, 32)
+	return err
+}
+
+// decodeProtocolData of Emmy (0x01) or Tenderbake (0x11) blocks
+// According to: https://gitlab.com/tezos/tezos/blob/master/src/proto_alpha/lib_protocol/block_header_repr.ml
+func (header *BlockHeader) decodeProtocolData(d *decoder, magicByte uint8) error {
+	var err error
+	if magicByte == opMagicByteBlock {
+		if header.Priority, err = d.readUint16(); err != nil {
+			return err
+		}
+	} else {
+		if header.PayloadHash, err = d.readHash(tzBlockPayloadHash, 32); err != nil {
+			return err
+		}
+		if header.PayloadRound, err = d.readInt32(); err != nil {
+			return err
+		}
+	}
+	if header.ProofOfWorkNonce, err = d.readBytes(8); err != nil {
+		return err
+	}
+	hasSeedNonceHash, err := d.readBool()
+	if err != nil {
+		return err
+	}
+	if hasSeedNonceHash {
+		if header.SeedNonceHash, err = d.readHash(tzNonceHash, 32); err != nil {
+			return err
+		}
+	}
+	if d.remaining() == 0 {
+		// Before Granada there was no liquidity baking
+		return nil
+	}
+	vote, err := d.readUint8()
+	if err != nil {
+		return err
+	}
+	switch {
+	case vote == 0xff:
+		// Escape votes of Granada to Ithaca
+		header.LiquidityBakingVote = liquidityBakingOff
+	case magicByte == opMagicByteBlock && vote != 0x00:
+		return fmt.Errorf("invalid liquidity baking escape vote 0x%02x", vote)
+	case vote&0x03 == 0:
+		// Since Oxford the upper bits hold the adaptive issuance vote
+		header.LiquidityBakingVote = liquidityBakingOn
+	case vote&0x03 == 1:
+		header.LiquidityBakingVote = liquidityBakingOff
+	case vote&0x03 == 2:
+		header.LiquidityBakingVote = liquidityBakingPass
+	default:
+		return fmt.Errorf("invalid liquidity baking vote 0x%02x", vote)
+	}
+	if d.remaining() != 0 {
+		return fmt.Errorf("%v unexpected bytes after block protocol data", d.remaining())
+	}
+	return nil
+}
+
+// evaluateBlock against the protocol and timestamp policies
+func (filter *OperationFilter) evaluateBlock(header *BlockHeader) []*FilterDecision {
+	if header.err != nil {
+		return []*FilterDecision{denyWith(ReasonParseError, "decode", "", "unable to decode the block header: "+header.err.Error())}
+	}
+	decisions := []*FilterDecision{}
+	if filter.BlockProtoLevels != nil {
+		if containsProtoLevel(filter.BlockProtoLevels, header.ProtoLevel) {
+			decisions = append(decisions, allow("block-proto-levels", "", fmt.Sprintf("proto level %v is allowed", header.ProtoLevel)))
+		} else {
+			decisions = append(decisions, deny("block-proto-levels", "", fmt.Sprintf("proto level %v is not allowed", header.ProtoLevel)))
+		}
+	}
+	if filter.BlockMaxSkew > 0 {
+		skew := time.Since(header.Timestamp)
+		if skew < 0 {
+			skew = -skew
+		}
+		reason := fmt.Sprintf("timestamp %v is %v from our clock", header.Timestamp, skew.Round(time.Second))
+		if skew > filter.BlockMaxSkew {
+			decisions = append(decisions, deny("block-max-skew", "", reason))
+		} else {
+			decisions = append(decisions, allow("block-max-skew", "", reason))
+		}
+	}
+	if len(decisions) == 0 {
+		decisions = append(decisions, allow("block", "", "blocks are protected by the watermark"))
+	}
+	return decisions
+}
+
+// containsProtoLevel is true if the level is in the list
+func containsProtoLevel(protoLevels []uint8, protoLevel uint8) bool {
+	for _, allowed := range protoLevels {
+		if allowed == protoLevel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package signer
+
+import (
+	"log"
+	"testing"
+	"time"
+)
+
+// testTenderbakeBlock reuses the shell header of testBlock, followed by
+// Tenderbake protocol data at round 2 passing on liquidity baking
+func testTenderbakeBlock() string {
+	shell := testBlock.Operation[3:273]
+	payloadHash := "3a1f46a1d6a3cc1ae4fbcd38a8eb89df2ff4f29a2ee5a2df4fa8a4f1a9fc6d39"
+	return "\"11" + shell + payloadHash + "00000002" + "000000000003dcf0" + "00" + "02" + "\""
+}
+
+func TestDecodeBlock(t *testing.T) {
+	op, _ := ParseOperation([]byte(testBlock.Operation))
+	header := GetBlockHeader(op)
+	if header.Err() != nil || header.ChainID != testBlock.ChainID || header.Level != 146930 || header.ProtoLevel != 1 {
+		log.Printf("[Block Test] Incorrectly decoded shell header: %+v\n", header)
+		t.Fail()
+	}
+	if header.Predecessor != "BLxboWrrMUfpC6AKAcLuYdh5hsGYesY5LP8haf95vavBUiKgaoK" || header.Timestamp.Unix() != 1549148768 {
+		log.Printf("[Block Test] Incorrectly decoded predecessor or timestamp: %+v\n", header)
+		t.Fail()
+	}
+	if len(header.Fitness) != 2 || header.Context != "CoWVttiKMvyTfcC4x4GVPgzAAhWYrcrCUNbfc2gqWm6Y3GdwDszd" {
+		log.Printf("[Block Test] Incorrectly decoded fitness or context: %+v\n", header)
+		t.Fail()
+	}
+	if header.Priority != 0 || len(header.ProofOfWorkNonce) != 8 || header.SeedNonceHash != "" {
+		log.Printf("[Block Test] Incorrectly decoded protocol data: %+v\n", header)
+		t.Fail()
+	}
+}
+
+func TestDecodeTenderbakeBlock(t *testing.T) {
+	op, err := ParseOperation([]byte(testTenderbakeBlock()))
+	if err != nil {
+		log.Println("[Tenderbake Block Test] Unable to parse:", err)
+		t.FailNow()
+	}
+	if op.Level().Int64() != 146930 || op.ChainID() != testBlock.ChainID {
+		log.Println("[Tenderbake Block Test] Incorrect level or chain ID")
+		t.Fail()
+	}
+	header := GetBlockHeader(op)
+	if header.PayloadRound != 2 || len(header.PayloadHash) != 52 || header.LiquidityBakingVote != liquidityBakingPass {
+		log.Printf("[Tenderbake Block Test] Incorrectly decoded protocol data: %+v\n", header)
+		t.Fail()
+	}
+}
+
+func TestBlockPolicies(t *testing.T) {
+	op, _ := ParseOperation([]byte(testBlock.Operation))
+
+	filter := &OperationFilter{}
+	if !filter.IsAllowed(op) {
+		log.Println("[Block Policy Test] Blocks should be allowed without policies")
+		t.Fail()
+	}
+	filter.BlockProtoLevels = []uint8{2, 3}
+	if filter.IsAllowed(op) {
+		log.Println("[Block Policy Test] Proto level 1 should not be allowed")
+		t.Fail()
+	}
+	filter.BlockProtoLevels = []uint8{1}
+	if !filter.IsAllowed(op) {
+		log.Println("[Block Policy Test] Proto level 1 should be allowed")
+		t.Fail()
+	}
+	filter.BlockMaxSkew = time.Minute
+	if filter.IsAllowed(op) {
+		log.Println("[Block Policy Test] Blocks from 2019 should be too old")
+		t.Fail()
+	}
+}
@@ -0,0 +1,175 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+)
+
+// Consensus slots above these are never assigned, bounding what we'll sign
+const (
+	emmyEndorsersPerBlock   = 256
+	tenderbakeCommitteeSize = 7000
+)
+
+// ConsensusOperation is a decoded endorsement, preendorsement, attestation or
+// preattestation.  Emmy endorsements only have a level and, since Edo, a slot.
+type ConsensusOperation struct {
+	ChainID        string        `json:"chain_id"`
+	Branch         string        `json:"branch"`
+	Kind           OperationKind `json:"kind"`
+	Slot           uint16        `json:"slot,omitempty"`
+	Level          int32         `json:"level"`
+	Round          int32         `json:"round,omitempty"`
+	PayloadHash    string        `json:"payload_hash,omitempty"`
+	DalAttestation *big.Int      `json:"dal_attestation,omitempty"`
+
+	err error
+}
+
+// Kinds allowed with each consensus magic byte
+var consensusKinds = map[uint8][]OperationKind{
+	opMagicByteEndorsement:              {opKindEndorsement, opKindEndorsementWithSlot},
+	opMagicByteTenderbakePreendorsement: {opKindPreendorsement, opKindPreattestation},
+	opMagicByteTenderbakeEndorsement:    {opKindEndorsement, opKindAttestation, opKindAttestationWithDal},
+}
+
+// GetConsensusOperation decodes the content of a consensus operation
+func GetConsensusOperation(op *Operation) *ConsensusOperation {
+	if consensusKinds[op.MagicByte()] == nil {
+		return nil
+	}
+	consensus, err := decodeConsensusOperation(op.MagicByte(), op.Hex()[1:])
+	if err != nil {
+		log.Println("[WARN] Unable to decode consensus operation:", err)
+		return &ConsensusOperation{err: err}
+	}
+	return consensus
+}
+
+// Err decoding the operation, if any
+func (op *ConsensusOperation) Err() error {
+	return op.err
+}
+
+// decodeConsensusOperation of the magic byte, verifying its content is of a
+// kind signed with that magic byte
+// According to: https://gitlab.com/tezos/tezos/blob/master/src/proto_alpha/lib_protocol/operation_repr.ml
+func decodeConsensusOperation(magicByte uint8, bytes []byte) (*ConsensusOperation, error) {
+	d := newDecoder(bytes)
+	op := &ConsensusOperation{}
+	var err error
+	if op.ChainID, err = d.readHash(tzChainID, 4); err != nil {
+		return nil, err
+	}
+	if op.Branch, err = d.readHash(tzBlockHash, 32); err != nil {
+		return nil, err
+	}
+	tag, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	// Emmy endorsements predate the protocols we identify kinds with
+	if magicByte == opMagicByteEndorsement {
+		op.Kind = edoTags[tag]
+	} else {
+		op.Kind = activeProtocol.Kind(tag)
+	}
+	if !isConsensusKind(magicByte, op.Kind) {
+		return nil, fmt.Errorf("content tag 0x%02x can't be signed with magic byte 0x%02x", tag, magicByte)
+	}
+
+	switch op.Kind {
+	case opKindEndorsement:
+		if magicByte == opMagicByteEndorsement {
+			op.Level, err = d.readInt32()
+		} else {
+			err = op.decodeTenderbake(d)
+		}
+	case opKindEndorsementWithSlot:
+		err = op.decodeEndorsementWithSlot(d)
+	case opKindPreendorsement, opKindPreattestation, opKindAttestation:
+		err = op.decodeTenderbake(d)
+	case opKindAttestationWithDal:
+		if err = op.decodeTenderbake(d); err == nil {
+			op.DalAttestation, err = d.readInt()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.remaining() != 0 {
+		return nil, fmt.Errorf("%v unexpected bytes after %v", d.remaining(), op.Kind)
+	}
+	return op, nil
+}
+
+// decodeTenderbake reads the slot, level, round and block payload hash
+func (op *ConsensusOperation) decodeTenderbake(d *decoder) error {
+	var err error
+	if op.Slot, err = d.readUint16(); err != nil {
+		return err
+	}
+	if op.Slot >= tenderbakeCommitteeSize {
+		return fmt.Errorf("slot %v is outside the consensus committee", op.Slot)
+	}
+	if op.Level, err = d.readInt32(); err != nil {
+		return err
+	}
+	if op.Round, err = d.readInt32(); err != nil {
+		return err
+	}
+	if op.Round < 0 {
+		return fmt.Errorf("invalid round %v", op.Round)
+	}
+	op.PayloadHash, err = d.readHash(tzBlockPayloadHash, 32)
+	return err
+}
+
+// decodeEndorsementWithSlot reads the signed endorsement it wraps, which must
+// endorse the same branch, followed by the slot
+func (op *ConsensusOperation) decodeEndorsementWithSlot(d *decoder) error {
+	inlined, err := d.readVariableBytes()
+	if err != nil {
+		return err
+	}
+	id := newDecoder(inlined)
+	branch, err := id.readHash(tzBlockHash, 32)
+	if err != nil {
+		return err
+	}
+	if branch != op.Branch {
+		return fmt.Errorf("endorsement of branch %v wrapped in branch %v", branch, op.Branch)
+	}
+	if tag, err := id.readUint8(); err != nil || tag != 0x00 {
+		return fmt.Errorf("endorsement with slot doesn't wrap an endorsement")
+	}
+	if op.Level, err = id.readInt32(); err != nil {
+		return err
+	}
+	// Signature of the wrapped endorsement
+	if _, err = id.readBytes(64); err != nil {
+		return err
+	}
+	if id.remaining() != 0 {
+		return fmt.Errorf("%v unexpected bytes after wrapped endorsement", id.remaining())
+	}
+	if op.Slot, err = d.readUint16(); err != nil {
+		return err
+	}
+	if op.Slot >= emmyEndorsersPerBlock {
+		return fmt.Errorf("slot %v is outside the endorsers of a block", op.Slot)
+	}
+	return nil
+}
+
+// isConsensusKind signed with the magic byte?
+func isConsensusKind(magicByte uint8, kind OperationKind) bool {
+	for _, allowed := range consensusKinds[magicByte] {
+		if allowed == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"testing"
+)
+
+const testPayloadHash = "3a1f46a1d6a3cc1ae4fbcd38a8eb89df2ff4f29a2ee5a2df4fa8a4f1a9fc6d39"
+
+// testTenderbakeConsensus forges a (pre)attestation on the branch of testEndorse
+func testTenderbakeConsensus(magicByte uint8, tag uint8, slot uint16, level int32, round int32) string {
+	chainAndBranch := testEndorse.Operation[3:75]
+	return fmt.Sprintf("\"%02x%v%02x%04x%08x%08x%v\"", magicByte, chainAndBranch, tag, slot, uint32(level), uint32(round), testPayloadHash)
+}
+
+func TestDecodeConsensus(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		kind      OperationKind
+		level     int32
+		round     int32
+	}{
+		{"Emmy Endorsement", testEndorse.Operation, opKindEndorsement, 256877, 0},
+		{"Preattestation", testTenderbakeConsensus(opMagicByteTenderbakePreendorsement, 0x14, 12, 259938, 0), opKindPreattestation, 259938, 0},
+		{"Attestation", testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x15, 12, 259938, 3), opKindAttestation, 259938, 3},
+	}
+	for _, test := range tests {
+		op, err := ParseOperation([]byte(test.operation))
+		if err != nil {
+			log.Printf("[Consensus Test - %v] Unable to parse: %v\n", test.name, err)
+			t.Fail()
+			continue
+		}
+		consensus := GetConsensusOperation(op)
+		if consensus.Err() != nil || consensus.Kind != test.kind || consensus.Level != test.level || consensus.Round != test.round {
+			log.Printf("[Consensus Test - %v] Incorrectly decoded: %+v\n", test.name, consensus)
+			t.Fail()
+		}
+		if consensus.ChainID != testEndorse.ChainID || op.Level().Int64() != int64(test.level) || op.Round() != test.round {
+			log.Printf("[Consensus Test - %v] Incorrect chain ID, level or round\n", test.name)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeEndorsementWithSlot(t *testing.T) {
+	branch := testEndorse.Operation[11:75]
+	signature := fmt.Sprintf("%0128x", 1)
+	endorsement := branch + "00" + "0003eb6d" + signature
+	operation := fmt.Sprintf("\"02%v%v0a%08x%v%04x\"", testEndorse.Operation[3:11], branch, len(endorsement)/2, endorsement, 5)
+
+	op, err := ParseOperation([]byte(operation))
+	if err != nil {
+		log.Println("[Endorsement With Slot Test] Unable to parse:", err)
+		t.FailNow()
+	}
+	consensus := GetConsensusOperation(op)
+	if consensus.Kind != opKindEndorsementWithSlot || consensus.Slot != 5 || op.Level().Int64() != 256877 {
+		log.Printf("[Endorsement With Slot Test] Incorrectly decoded: %+v\n", consensus)
+		t.Fail()
+	}
+
+	otherBranch := fmt.Sprintf("%064x", 1) + "00" + "0003eb6d" + signature
+	operation = fmt.Sprintf("\"02%v%v0a%08x%v%04x\"", testEndorse.Operation[3:11], branch, len(otherBranch)/2, otherBranch, 5)
+	if _, err := ParseOperation([]byte(operation)); err == nil {
+		log.Println("[Endorsement With Slot Test] Endorsements of another branch should fail")
+		t.Fail()
+	}
+}
+
+func TestConsensusSanity(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+	}{
+		{"Preattestation Signed As Attestation", testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x14, 0, 1, 0)},
+		{"Attestation Signed As Preattestation", testTenderbakeConsensus(opMagicByteTenderbakePreendorsement, 0x15, 0, 1, 0)},
+		{"Attestation Signed As Emmy Endorsement", testTenderbakeConsensus(opMagicByteEndorsement, 0x15, 0, 1, 0)},
+		{"Slot Outside Committee", testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x15, 7000, 1, 0)},
+		{"Negative Round", testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x15, 0, 1, -1)},
+		{"Trailing Bytes", testEndorse.Operation[:len(testEndorse.Operation)-1] + "00\""},
+	}
+	for _, test := range tests {
+		if _, err := ParseOperation([]byte(test.operation)); err == nil {
+			log.Printf("[Consensus Sanity Test - %v] Expected a parse error\n", test.name)
+			t.Fail()
+		}
+	}
+}
+
+func TestPostAttestationRounds(t *testing.T) {
+	server := getTestServer("tz123")
+	attest := func(level int32, round int32) testOperation {
+		test := testEndorse
+		test.Operation = testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x15, 0, level, round)
+		return test
+	}
+
+	// Higher rounds of the same level may be signed, but never a round twice
+	resp, body := testPost(t, server, attest(259938, 0))
+	compare(t, "Attestation Round 0", resp.StatusCode, http.StatusOK, body, testEndorse.SignerResponse)
+	resp, body = testPost(t, server, attest(259938, 1))
+	compare(t, "Attestation Round 1", resp.StatusCode, http.StatusOK, body, testEndorse.SignerResponse)
+	resp, body = testPost(t, server, attest(259938, 1))
+	compare(t, "Attestation Round 1 Again", resp.StatusCode, http.StatusForbidden, body, testEndorse.SignerResponse)
+	resp, body = testPost(t, server, attest(259938, 0))
+	compare(t, "Attestation Lower Round", resp.StatusCode, http.StatusForbidden, body, testEndorse.SignerResponse)
+	resp, body = testPost(t, server, attest(259939, 0))
+	compare(t, "Attestation Next Level", resp.StatusCode, http.StatusOK, body, testEndorse.SignerResponse)
+}
@@ -0,0 +1,232 @@
+package signer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Base58 prefixes of hashes found inside operations
+// According to: https://gitlab.com/tezos/tezos/blob/master/src/lib_crypto/base58.ml
+const (
+	tzBlockHash           = "0134"     // B(51)
+	tzProtocolHash        = "02aa"     // P(51)
+	tzContractHash        = "025a79"   // KT1(36)
+	tzBLS12_381PublicKey  = "069587cc" // BLpk(76)
+	tzBLS12_381PublicHash = "06a1a6"   // tz4(36)
+)
+
+// errEndOfBytes is returned when a field runs past the end of the operation
+var errEndOfBytes = errors.New("unexpected end of operation bytes")
+
+// HexBytes are raw bytes of an operation, marshaled to JSON as hex
+type HexBytes []byte
+
+// MarshalJSON as a hex string
+func (bytes HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(bytes))
+}
+
+// decoder reads sequentially serialized fields from an operation.  Encodings
+// follow https://gitlab.com/tezos/tezos/blob/master/src/lib_data_encoding
+type decoder struct {
+	bytes  []byte
+	offset int
+}
+
+// newDecoder reading from the start of the provided bytes
+func newDecoder(bytes []byte) *decoder {
+	return &decoder{bytes: bytes}
+}
+
+// remaining bytes that have not been read yet
+func (d *decoder) remaining() int {
+	return len(d.bytes) - d.offset
+}
+
+// readBytes returns the next n bytes
+func (d *decoder) readBytes(n int) ([]byte, error) {
+	if n < 0 || d.remaining() < n {
+		return nil, fmt.Errorf("%w: reading %v bytes at offset %v", errEndOfBytes, n, d.offset)
+	}
+	bytes := d.bytes[d.offset : d.offset+n]
+	d.offset += n
+	return bytes, nil
+}
+
+// readUint8 reads a single byte
+func (d *decoder) readUint8() (uint8, error) {
+	bytes, err := d.readBytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return bytes[0], nil
+}
+
+// readUint16 reads a big-endian uint16
+func (d *decoder) readUint16() (uint16, error) {
+	bytes, err := d.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(bytes), nil
+}
+
+// readInt32 reads a big-endian int32
+func (d *decoder) readInt32() (int32, error) {
+	bytes, err := d.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(bytes)), nil
+}
+
+// readInt64 reads a big-endian int64
+func (d *decoder) readInt64() (int64, error) {
+	bytes, err := d.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(bytes)), nil
+}
+
+// readBool reads a 0x00 or 0xff boolean, also used to tag optional fields
+func (d *decoder) readBool() (bool, error) {
+	b, err := d.readUint8()
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0x00:
+		return false, nil
+	case 0xff:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid boolean 0x%02x at offset %v", b, d.offset-1)
+	}
+}
+
+// readNat reads an arbitrary-precision natural number (zarith N), stored
+// little-endian in groups of 7 bits where the top bit marks continuation.
+// Follows https://gitlab.com/tezos/tezos/blob/master/src/lib_data_encoding/binary_reader.ml#L174
+func (d *decoder) readNat() (*big.Int, error) {
+	num := new(big.Int)
+	shift := uint(0)
+	for {
+		b, err := d.readUint8()
+		if err != nil {
+			return nil, err
+		}
+		group := new(big.Int).SetInt64(int64(b & 0x7f))
+		num.Or(num, group.Lsh(group, shift))
+		shift += 7
+		if b < 0x80 {
+			return num, nil
+		}
+	}
+}
+
+// readInt reads an arbitrary-precision signed integer (zarith Z).  The first
+// byte holds the sign in bit 6 and the 6 lowest bits of the number.
+func (d *decoder) readInt() (*big.Int, error) {
+	first, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+	num := new(big.Int).SetInt64(int64(first & 0x3f))
+	if first >= 0x80 {
+		rest, err := d.readNat()
+		if err != nil {
+			return nil, err
+		}
+		num.Or(num, rest.Lsh(rest, 6))
+	}
+	if first&0x40 != 0 {
+		num.Neg(num)
+	}
+	return num, nil
+}
+
+// readVariableBytes reads bytes prefixed by their 4 byte length
+func (d *decoder) readVariableBytes() ([]byte, error) {
+	length, err := d.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(int(length))
+}
+
+// readHash reads a fixed size hash and base58 check encodes it
+func (d *decoder) readHash(prefix string, size int) (string, error) {
+	bytes, err := d.readBytes(size)
+	if err != nil {
+		return "", err
+	}
+	prefixBytes, _ := hex.DecodeString(prefix)
+	return b58CheckEncode(prefixBytes, bytes), nil
+}
+
+// readPublicKeyHash reads a tagged 21 byte tz1, tz2, tz3 or tz4 address
+func (d *decoder) readPublicKeyHash() (string, error) {
+	tag, err := d.readUint8()
+	if err != nil {
+		return "", err
+	}
+	switch tag {
+	case 0x00:
+		return d.readHash(tzEd25519PublicKeyHash, 20)
+	case 0x01:
+		return d.readHash(tzSecp256k1PublicKeyHash, 20)
+	case 0x02:
+		return d.readHash(tzP256PublicKeyHash, 20)
+	case 0x03:
+		return d.readHash(tzBLS12_381PublicHash, 20)
+	default:
+		return "", fmt.Errorf("unknown public key hash tag 0x%02x at offset %v", tag, d.offset-1)
+	}
+}
+
+// readContractID reads a 22 byte implicit or originated contract address
+func (d *decoder) readContractID() (string, error) {
+	tag, err := d.readUint8()
+	if err != nil {
+		return "", err
+	}
+	switch tag {
+	case 0x00:
+		return d.readPublicKeyHash()
+	case 0x01:
+		contract, err := d.readHash(tzContractHash, 20)
+		if err != nil {
+			return "", err
+		}
+		// Originated contracts are padded to the size of implicit ones
+		_, err = d.readBytes(1)
+		return contract, err
+	default:
+		return "", fmt.Errorf("unknown contract tag 0x%02x at offset %v", tag, d.offset-1)
+	}
+}
+
+// readPublicKey reads a tagged public key
+func (d *decoder) readPublicKey() (string, error) {
+	tag, err := d.readUint8()
+	if err != nil {
+		return "", err
+	}
+	switch tag {
+	case 0x00:
+		return d.readHash(tzEd25519PublicKey, 32)
+	case 0x01:
+		return d.readHash(tzSecp256k1PublicKey, 33)
+	case 0x02:
+		return d.readHash(tzP256PublicKey, 33)
+	case 0x03:
+		return d.readHash(tzBLS12_381PublicKey, 48)
+	default:
+		return "", fmt.Errorf("unknown public key tag 0x%02x at offset %v", tag, d.offset-1)
+	}
+}
@@ -0,0 +1,95 @@
+package signer
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Description of an operation and how the filter judges it, without signing
+type Description struct {
+	MagicByte string              `json:"magic_byte"`
+	Type      string              `json:"type"`
+	ChainID   string              `json:"chain_id,omitempty"`
+	Level     *big.Int            `json:"level,omitempty"`
+	Round     *int32              `json:"round,omitempty"`
+	Watermark *big.Int            `json:"watermark,omitempty"`
+	Block     *BlockHeader        `json:"block,omitempty"`
+	Consensus *ConsensusOperation `json:"consensus,omitempty"`
+	Branch    string              `json:"branch,omitempty"`
+	Contents  []*ContentSummary   `json:"contents,omitempty"`
+	Packed    *Micheline          `json:"packed_data,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Allowed   bool                `json:"allowed"`
+	Decisions []*FilterDecision   `json:"decisions"`
+}
+
+// ContentSummary of a single content of a generic operation batch
+type ContentSummary struct {
+	Kind    OperationKind    `json:"kind"`
+	Content OperationContent `json:"content"`
+}
+
+// Names of the operations signed with each magic byte
+var magicByteTypes = map[uint8]string{
+	opMagicByteBlock:                    "block",
+	opMagicByteEndorsement:              "endorsement",
+	opMagicByteGeneric:                  "generic",
+	opMagicBytePackedData:               "packed_data",
+	opMagicByteTenderbakeBlock:          "tenderbake_block",
+	opMagicByteTenderbakePreendorsement: "tenderbake_preendorsement",
+	opMagicByteTenderbakeEndorsement:    "tenderbake_endorsement",
+}
+
+// Describe a parsed operation and explain how the filter would judge it
+func (filter *OperationFilter) Describe(op *Operation) *Description {
+	return filter.DescribeForKey(op, nil)
+}
+
+// DescribeForKey explains how the policy of the key would judge the operation
+func (filter *OperationFilter) DescribeForKey(op *Operation, key *Key) *Description {
+	description := &Description{
+		MagicByte: fmt.Sprintf("0x%02x", op.MagicByte()),
+		Type:      magicByteTypes[op.MagicByte()],
+	}
+
+	switch op.MagicByte() {
+	case opMagicByteBlock, opMagicByteTenderbakeBlock:
+		description.Block = GetBlockHeader(op)
+		description.Error = errorString(description.Block.err)
+	case opMagicByteEndorsement, opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		description.Consensus = GetConsensusOperation(op)
+		description.Error = errorString(description.Consensus.err)
+	case opMagicByteGeneric:
+		generic := GetGenericOperation(op)
+		description.Branch = generic.Branch()
+		for _, content := range generic.contents {
+			description.Contents = append(description.Contents, &ContentSummary{Kind: content.Kind(), Content: content})
+		}
+		description.Error = errorString(generic.err)
+	case opMagicBytePackedData:
+		var err error
+		description.Packed, err = GetPackedData(op)
+		description.Error = errorString(err)
+	}
+	if (description.Block != nil || description.Consensus != nil) && len(description.Error) == 0 {
+		description.ChainID = op.ChainID()
+		description.Level = op.Level()
+		description.Watermark = op.Watermark()
+		if op.MagicByte() != opMagicByteBlock && op.MagicByte() != opMagicByteEndorsement {
+			round := op.Round()
+			description.Round = &round
+		}
+	}
+
+	description.Decisions = filter.ExplainForKey(op, key)
+	description.Allowed = allAllowed(description.Decisions)
+	return description
+}
+
+// errorString of err, or empty if there's no error
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -1,6 +1,7 @@
 package signer
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -86,6 +87,26 @@ func b58CheckEncode(prefix []byte, bytes []byte) string {
 	return encoded
 }
 
+// b58CheckDecode verifies the checksum and prefix of a b58 check encoded
+// string, returning the bytes after the prefix
+func b58CheckDecode(encoded string, prefix string) ([]byte, error) {
+	prefixBytes, _ := hex.DecodeString(prefix)
+	decoded := base58.Decode(encoded)
+	if len(decoded) < len(prefixBytes)+4 {
+		return nil, fmt.Errorf("%q is too short", encoded)
+	}
+	message, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	h := sha256.Sum256(message)
+	h2 := sha256.Sum256(h[:])
+	if !bytes.Equal(h2[:4], checksum) {
+		return nil, fmt.Errorf("invalid checksum of %q", encoded)
+	}
+	if !bytes.HasPrefix(message, prefixBytes) {
+		return nil, fmt.Errorf("%q doesn't have the expected prefix", encoded)
+	}
+	return message[len(prefixBytes):], nil
+}
+
 // PubkeyHashToByteString strips the prefix and checksum bytes,
 // returning only the pubkeyhash bytes
 func PubkeyHashToByteString(pubkeyhash string) string {
@@ -99,3 +120,24 @@ func PubkeyHashToByteString(pubkeyhash string) string {
 		return "02" + hex.EncodeToString(base58.Decode(pubkeyhash)[3:23])
 	}
 }
+
+// ByteStringToPubkeyHash encodes a tagged 21 byte public key hash, as
+// serialized in operations, back into its tz1, tz2 or tz3 address
+func ByteStringToPubkeyHash(byteString string) string {
+	bytes, err := hex.DecodeString(byteString)
+	if err != nil || len(bytes) != 21 {
+		return ""
+	}
+	var prefix []byte
+	switch bytes[0] {
+	case 0x00:
+		prefix, _ = hex.DecodeString(tzEd25519PublicKeyHash)
+	case 0x01:
+		prefix, _ = hex.DecodeString(tzSecp256k1PublicKeyHash)
+	case 0x02:
+		prefix, _ = hex.DecodeString(tzP256PublicKeyHash)
+	default:
+		return ""
+	}
+	return b58CheckEncode(prefix, bytes[1:])
+}
@@ -14,70 +14,427 @@ type OperationFilter struct {
 	EnableVoting         bool
 	TxWhitelistAddresses []string
 	TxDailyMax           *big.Int
+	TokenPolicies        []*TokenPolicy
+	BlockProtoLevels     []uint8
+	BlockMaxSkew         time.Duration
+	// Baker operations, each enabled individually.  Nil lists allow any
+	// baker, consensus key or drain destination.
+	EnableReveal             bool
+	EnableDelegation         bool
+	EnableSetDepositsLimit   bool
+	EnableUpdateConsensusKey bool
+	EnableDrainDelegate      bool
+	DelegationBakers         []string
+	ConsensusKeys            []string
+	DrainDestinations        []string
+	// Proposal hashes and ballot values (yay, nay or pass) that can be voted.
+	// Nil allows any.
+	VotingProposals []string
+	VotingBallots   []string
+	// Caps on the totals of a generic operation's contents.  Nil is no cap.
+	MaxFee          *big.Int
+	MaxGasLimit     *big.Int
+	MaxStorageLimit *big.Int
+	// CostPerByte of storage burnt, in uXTZ.  Defaults to the protocol's.
+	CostPerByte *big.Int
+	// Ordered rules of the policy file, replacing EnableGeneric, EnableTx and
+	// EnableVoting
+	PolicyRules []*PolicyRule
 
-	// Keep track of daily max withdrawals
-	dailyTxMaxKey     string
-	dailyTxMaxCounter *big.Int
+	// Restrictions of key policies.  Nil allows everything.
+	MagicBytes []uint8
+	Chains     []string
+	// Kinds of generic operation contents allowed, replacing EnableTx and
+	// EnableVoting
+	Kinds []OperationKind
+	// AllowUndecoded contents, whose body isn't checked, if their kind is
+	// allowed
+	AllowUndecoded bool
+
+	// Limiter of spends counted towards daily limits over a rolling window.
+	// Defaults to an in-memory ledger.
+	Limiter *Limiter
+	// Ledger account of TxDailyMax, shared by key policies without their own
+	txAccount string
+}
+
+// Spend of an allowed operation, reserved towards a daily limit of Max
+type Spend struct {
+	Account string
+	Amount  *big.Int
+	Max     *big.Int
+}
+
+// Ledger account of the global --tx-daily-max
+const txDailyMaxAccount = "tx"
+
+// FilterDecision explains how one rule of the filter judged an operation.
+// Rules are named after the flags that configure them.
+type FilterDecision struct {
+	Rule    string `json:"rule"`
+	Subject string `json:"subject,omitempty"`
+	Allowed bool   `json:"allowed"`
+	Code    string `json:"code"`
+	Reason  string `json:"reason"`
+
+	// Spent if the operation is signed
+	spend *Spend
+}
+
+// allow the subject of an operation by this rule
+func allow(rule string, subject string, reason string) *FilterDecision {
+	return &FilterDecision{Rule: rule, Subject: subject, Allowed: true, Code: ReasonAllowed, Reason: reason}
+}
+
+// deny the subject of an operation by this rule
+func deny(rule string, subject string, reason string) *FilterDecision {
+	return &FilterDecision{Rule: rule, Subject: subject, Allowed: false, Code: ReasonFiltered, Reason: reason}
+}
+
+// denyWith a reason code other than filtered, e.g. a daily limit exceeded
+func denyWith(code string, rule string, subject string, reason string) *FilterDecision {
+	return &FilterDecision{Rule: rule, Subject: subject, Allowed: false, Code: code, Reason: reason}
+}
+
+// allAllowed is true if no decision blocks the operation
+func allAllowed(decisions []*FilterDecision) bool {
+	for _, decision := range decisions {
+		if !decision.Allowed {
+			return false
+		}
+	}
+	return true
 }
 
-// IsAllowed by this filter?
+// IsAllowed by this filter?  Allowed transfers count towards daily limits.
 func (filter *OperationFilter) IsAllowed(op *Operation) bool {
+	return filter.IsAllowedForKey(op, nil)
+}
+
+// IsAllowedForKey by the policy of the key, falling back to this filter.
+// Allowed transfers count towards daily limits.
+func (filter *OperationFilter) IsAllowedForKey(op *Operation, key *Key) bool {
+	reservation, blocked := filter.Authorize(op, key)
+	if blocked != nil {
+		log.Printf("[WARN] Operation blocked by %v: %v\n", blocked.Rule, blocked.Reason)
+		return false
+	}
+	reservation.Commit()
+	return true
+}
+
+// Authorize the operation for the key, reserving what it spends towards
+// daily limits.  The reservation must be committed once the operation is
+// signed, or released.  If the operation is blocked, returns the first
+// decision that blocks it instead.
+func (filter *OperationFilter) Authorize(op *Operation, key *Key) (*Reservation, *FilterDecision) {
+	spending := []*FilterDecision{}
+	for _, decision := range filter.forKey(key).evaluate(op, key) {
+		if !decision.Allowed {
+			return nil, decision
+		}
+		if decision.spend != nil {
+			spending = append(spending, decision)
+		}
+	}
+	return filter.limits().reserve(spending)
+}
+
+// Explain how every rule of this filter judges the operation, without
+// counting it towards daily limits
+func (filter *OperationFilter) Explain(op *Operation) []*FilterDecision {
+	return filter.ExplainForKey(op, nil)
+}
+
+// ExplainForKey how the policy of the key judges the operation
+func (filter *OperationFilter) ExplainForKey(op *Operation, key *Key) []*FilterDecision {
+	return filter.forKey(key).evaluate(op, key)
+}
+
+// forKey returns the filter derived from the key's policy, or this filter if
+// the key has none
+func (filter *OperationFilter) forKey(key *Key) *OperationFilter {
+	// Key policies share the global limiter
+	filter.limits()
+	if key == nil || key.Policy == nil {
+		return filter
+	}
+	return key.Policy.filterFrom(filter, key)
+}
+
+// evaluate the rules that apply to the operation
+func (filter *OperationFilter) evaluate(op *Operation, key *Key) []*FilterDecision {
+	decisions := []*FilterDecision{}
+	if filter.MagicBytes != nil {
+		if !containsMagicByte(filter.MagicBytes, op.MagicByte()) {
+			return append(decisions, deny("magic-bytes", "", fmt.Sprintf("magic byte 0x%02x is not allowed", op.MagicByte())))
+		}
+		decisions = append(decisions, allow("magic-bytes", "", fmt.Sprintf("magic byte 0x%02x is allowed", op.MagicByte())))
+	}
+	if filter.Chains != nil && hasChainID(op.MagicByte()) {
+		if !containsString(filter.Chains, op.ChainID()) {
+			return append(decisions, deny("chains", "", op.ChainID()+" is not allowed"))
+		}
+		decisions = append(decisions, allow("chains", "", op.ChainID()+" is allowed"))
+	}
+	if filter.PolicyRules != nil {
+		decisions = append(decisions, filter.evaluatePolicy(op, key)...)
+	}
+	return append(decisions, filter.evaluateMagicByte(op, key)...)
+}
+
+// evaluateMagicByte with the rules of the operation's type
+func (filter *OperationFilter) evaluateMagicByte(op *Operation, key *Key) []*FilterDecision {
 	switch op.MagicByte() {
-	case opMagicByteBlock, opMagicByteEndorsement:
-		return true
+	case opMagicByteBlock, opMagicByteTenderbakeBlock:
+		return filter.evaluateBlock(GetBlockHeader(op))
+	case opMagicByteEndorsement, opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		return []*FilterDecision{allow("consensus", "", "consensus operations are protected by the watermark")}
 	case opMagicByteGeneric:
-		generic := GetGenericOperation(op)
-		if filter.EnableGeneric {
-			return true
+		return filter.evaluateGeneric(GetGenericOperation(op), key)
+	case opMagicBytePackedData:
+		if key == nil {
+			return []*FilterDecision{deny("packed-data", "", "packed data is only signed by keys with a PackedData policy")}
+		}
+		return []*FilterDecision{key.evaluatePackedData(op)}
+	default:
+		return []*FilterDecision{deny("magic-byte", "", fmt.Sprintf("unsupported magic byte 0x%02x", op.MagicByte()))}
+	}
+}
+
+// evaluateGeneric operations.  Every content of the batch must be allowed.
+func (filter *OperationFilter) evaluateGeneric(generic *GenericOperation, key *Key) []*FilterDecision {
+	decisions := filter.evaluateCaps(generic)
+	if filter.EnableGeneric && filter.PolicyRules == nil {
+		return append(decisions, allow("enable-generic", "", "every generic operation is enabled"))
+	}
+	contents, err := generic.Contents()
+	if err != nil {
+		return []*FilterDecision{denyWith(ReasonParseError, "decode", "", "unable to decode every content of the batch: "+err.Error())}
+	}
+
+	batchValue := new(big.Int)
+	costPerByte := filter.costPerByte()
+	tokenValues := map[*TokenPolicy]*big.Int{}
+	for i, content := range contents {
+		subject := fmt.Sprintf("content %v (%v)", i, content.Kind())
+		batchValue.Add(batchValue, contentValue(content, costPerByte))
+		tx, isTransaction := content.(*Transaction)
+		if isTransaction && filter.isTokenCall(tx) {
+			// Token calls are allowed by their policies rather than --enable-tx
+			if filter.Kinds != nil {
+				decisions = append(decisions, filter.evaluateKind(subject, content))
+			}
+			decisions = append(decisions, filter.evaluateTokenCall(subject, tx, tokenValues)...)
+			continue
 		}
-		if filter.EnableTx && generic.Kind() == opKindTransaction {
-			return filter.isWhitelisted(generic) && filter.authorizeTxAmount(generic.TransactionValue())
+		if undecoded, ok := content.(*UndecodedOperation); ok {
+			decisions = append(decisions, filter.evaluateUndecoded(subject, undecoded))
 		}
-		if filter.EnableVoting && (generic.Kind() == opKindBallot) {
-			return true
+		if filter.Kinds != nil || filter.PolicyRules == nil {
+			// Otherwise kinds are matched by the policy file
+			decisions = append(decisions, filter.evaluateKind(subject, content))
 		}
-		if filter.EnableVoting && (generic.Kind() == opKindProposal) {
-			return true
+		if decision := filter.evaluateBakerParameters(subject, content, key); decision != nil {
+			decisions = append(decisions, decision)
 		}
-		return false
+		if decision := filter.evaluateVote(subject, content); decision != nil {
+			decisions = append(decisions, decision)
+		}
+		if isTransaction {
+			decisions = append(decisions, filter.evaluateWhitelist(subject, tx))
+		}
+	}
+
+	for _, policy := range filter.TokenPolicies {
+		if value, ok := tokenValues[policy]; ok {
+			decisions = append(decisions, filter.evaluateTokenAmount(policy, value))
+		}
+	}
+	if batchValue.Sign() > 0 {
+		decisions = append(decisions, filter.evaluateTxAmount(batchValue))
+	}
+	return decisions
+}
+
+// evaluateCaps on the total fee, gas limit and storage limit of the batch
+func (filter *OperationFilter) evaluateCaps(generic *GenericOperation) []*FilterDecision {
+	if filter.MaxFee == nil && filter.MaxGasLimit == nil && filter.MaxStorageLimit == nil {
+		return []*FilterDecision{}
+	}
+	contents, err := generic.Contents()
+	if err != nil {
+		return []*FilterDecision{denyWith(ReasonParseError, "decode", "", "unable to decode every content of the batch: "+err.Error())}
+	}
+	fee, gasLimit, storageLimit := new(big.Int), new(big.Int), new(big.Int)
+	for _, content := range contents {
+		if manager := managerOf(content); manager != nil {
+			fee.Add(fee, manager.Fee)
+			gasLimit.Add(gasLimit, manager.GasLimit)
+			storageLimit.Add(storageLimit, manager.StorageLimit)
+		}
+	}
+	decisions := []*FilterDecision{}
+	if filter.MaxFee != nil {
+		decisions = append(decisions, evaluateCap("max-fee", fee, filter.MaxFee, "uXTZ of fees"))
+	}
+	if filter.MaxGasLimit != nil {
+		decisions = append(decisions, evaluateCap("max-gas-limit", gasLimit, filter.MaxGasLimit, "gas"))
+	}
+	if filter.MaxStorageLimit != nil {
+		decisions = append(decisions, evaluateCap("max-storage-limit", storageLimit, filter.MaxStorageLimit, "bytes of storage"))
+	}
+	return decisions
+}
+
+// evaluateCap allows totals up to and including the cap
+func evaluateCap(rule string, total *big.Int, max *big.Int, unit string) *FilterDecision {
+	reason := fmt.Sprintf("%v of at most %v %v", total, max, unit)
+	if total.Cmp(max) > 0 {
+		return deny(rule, "", reason)
+	}
+	return allow(rule, "", reason)
+}
+
+// costPerByte of storage, configured or of the active protocol
+func (filter *OperationFilter) costPerByte() *big.Int {
+	if filter.CostPerByte != nil {
+		return filter.CostPerByte
+	}
+	return big.NewInt(activeProtocol.CostPerByte)
+}
+
+// evaluateKind of a content, allowed by the kinds of a key policy or else by
+// the enable flags
+func (filter *OperationFilter) evaluateKind(subject string, content OperationContent) *FilterDecision {
+	if filter.Kinds != nil {
+		if containsKind(filter.Kinds, content.Kind()) {
+			return allow("kinds", subject, "this kind of operation is allowed")
+		}
+		return deny("kinds", subject, "this kind of operation is not allowed")
+	}
+	switch content.(type) {
+	case *Transaction:
+		return evaluateEnabled("enable-tx", subject, filter.EnableTx, "transfers")
+	case *Ballot, *Proposals:
+		return evaluateEnabled("enable-voting", subject, filter.EnableVoting, "voting")
+	case *Reveal:
+		return evaluateEnabled("enable-reveal", subject, filter.EnableReveal, "reveals")
+	case *Delegation:
+		return evaluateEnabled("enable-delegation", subject, filter.EnableDelegation, "delegations")
+	case *SetDepositsLimit:
+		return evaluateEnabled("enable-set-deposits-limit", subject, filter.EnableSetDepositsLimit, "deposits limits")
+	case *UpdateConsensusKey:
+		return evaluateEnabled("enable-update-consensus-key", subject, filter.EnableUpdateConsensusKey, "consensus key updates")
+	case *DrainDelegate:
+		return evaluateEnabled("enable-drain-delegate", subject, filter.EnableDrainDelegate, "drains")
 	default:
-		return false
+		return deny("kind", subject, "this kind of operation is never allowed without --enable-generic")
+	}
+}
+
+// evaluateUndecoded content, whose body can't be checked by any other rule
+func (filter *OperationFilter) evaluateUndecoded(subject string, content *UndecodedOperation) *FilterDecision {
+	if filter.AllowUndecoded {
+		return allow("allow-undecoded", subject, "undecoded operations are allowed by the key's policy")
 	}
+	return deny("allow-undecoded", subject, "the body of this kind of operation isn't decoded, so the key's policy must set AllowUndecoded")
 }
 
-// Is this address whitelisted? Returns true if whitelistising is disabled
-func (filter *OperationFilter) isWhitelisted(generic *GenericOperation) bool {
+// evaluateEnabled kind of operation, by the flag of the rule
+func evaluateEnabled(rule string, subject string, enabled bool, kinds string) *FilterDecision {
+	if enabled {
+		return allow(rule, subject, kinds+" are enabled")
+	}
+	return deny(rule, subject, kinds+" are disabled")
+}
+
+// evaluateWhitelist of transfer destinations.  Allowed if whitelisting is
+// disabled
+func (filter *OperationFilter) evaluateWhitelist(subject string, tx *Transaction) *FilterDecision {
 	if filter.TxWhitelistAddresses == nil {
-		debugln("[isWhitelisted] No whitelist set.  Allowing transfer.")
-		return true
+		debugln("[evaluateWhitelist] No whitelist set.  Allowing transfer.")
+		return allow("tx-whitelist-addresses", subject, "no whitelist is set")
 	}
 	for _, pkh := range filter.TxWhitelistAddresses {
-		if generic.TransactionDestination() == PubkeyHashToByteString(pkh) {
-			debugln("[isWhitelisted] Address is whitelisted.  Allowing transfer")
+		if tx.Destination == pkh {
+			debugln("[evaluateWhitelist] Address is whitelisted.  Allowing transfer")
+			return allow("tx-whitelist-addresses", subject, tx.Destination+" is whitelisted")
+		}
+	}
+	return deny("tx-whitelist-addresses", subject, tx.Destination+" is not whitelisted")
+}
+
+// evaluateTxAmount for withdrawal.  Fails if this amount would push us over
+// the daily limit in XTZ.  Allowed if limits are disabled
+func (filter *OperationFilter) evaluateTxAmount(value *big.Int) *FilterDecision {
+	if filter.TxDailyMax == nil {
+		debugln("[evaluateTxAmount] No rate limit set.  Allowing transfer.")
+		return allow("tx-daily-max", "", "no daily limit is set")
+	}
+
+	account := filter.txAccount
+	if len(account) == 0 {
+		account = txDailyMaxAccount
+	}
+	total, authorized, err := filter.authorize(account, filter.TxDailyMax, value)
+	if err != nil {
+		return denyWith(ReasonBackendError, "tx-daily-max", "", "unable to read the ledger: "+err.Error())
+	}
+	debugln("[evaluateTxAmount] authorized result: ", authorized)
+	reason := fmt.Sprintf("%v of the daily max of %v uXTZ spent", total, filter.TxDailyMax)
+	if !authorized {
+		return denyWith(ReasonLimitExceeded, "tx-daily-max", "", reason)
+	}
+	decision := allow("tx-daily-max", "", reason)
+	decision.spend = &Spend{Account: account, Amount: value, Max: filter.TxDailyMax}
+	return decision
+}
+
+// authorize adding value to what the account spent over the last day,
+// including reservations, which is returned.  Fails if the total would reach
+// max.  Concurrent requests may both pass, so the ledger checks again when
+// reserving.
+func (filter *OperationFilter) authorize(account string, max *big.Int, value *big.Int) (*big.Int, bool, error) {
+	spent, err := filter.limits().spent(account)
+	if err != nil {
+		return nil, false, err
+	}
+	total := new(big.Int).Add(spent, value)
+	return total, total.Cmp(max) == -1, nil
+}
+
+// hasChainID is true for operations that include the chain they're signed for
+func hasChainID(magicByte uint8) bool {
+	return magicByte != opMagicByteGeneric && magicByte != opMagicBytePackedData
+}
+
+// containsMagicByte is true if the magic byte is in the list
+func containsMagicByte(magicBytes []uint8, magicByte uint8) bool {
+	for _, allowed := range magicBytes {
+		if allowed == magicByte {
 			return true
 		}
 	}
-	log.Println("[WARN] Address is not whitelisted")
 	return false
 }
 
-// AuthorizeTxAmount for withdrawal.  Fails if this amount would push us
-// over the daily limit in XTZ.  Returns true if limits are disabled
-func (filter *OperationFilter) authorizeTxAmount(value *big.Int) bool {
-	if filter.TxDailyMax == nil {
-		debugln("[authorizeTxAmount] No rate limit set.  Allowing transfer.")
-		return true
+// containsKind is true if the kind is in the list
+func containsKind(kinds []OperationKind, kind OperationKind) bool {
+	for _, allowed := range kinds {
+		if allowed == kind {
+			return true
+		}
 	}
+	return false
+}
 
-	now := time.Now()
-	key := fmt.Sprintf("%v-%v", now.Year(), now.YearDay())
-	// Reset the counter when we're in a new day
-	if filter.dailyTxMaxKey != key {
-		filter.dailyTxMaxKey = key
-		filter.dailyTxMaxCounter = new(big.Int).SetInt64(0)
+// containsString is true if the string is in the list
+func containsString(strs []string, str string) bool {
+	for _, allowed := range strs {
+		if allowed == str {
+			return true
+		}
 	}
-	filter.dailyTxMaxCounter.Add(filter.dailyTxMaxCounter, value)
-	authorized := filter.dailyTxMaxCounter.Cmp(filter.TxDailyMax) == -1
-	debugln("[authorizeTxAmount] authorized result: ", authorized)
-	return authorized
+	return false
 }
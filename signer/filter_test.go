@@ -0,0 +1,37 @@
+package signer
+
+import (
+	"log"
+	"math/big"
+	"testing"
+)
+
+func TestTransactionValue(t *testing.T) {
+	op, _ := ParseOperation([]byte(testPolicyTransfer(false, 1000000, 1000)))
+	// Amount, fee and 4 bytes of storage burnt at 250 uXTZ each.  Gas is
+	// paid for by the fee.
+	value := GetGenericOperation(op).TransactionValue()
+	if value == nil || value.Cmp(big.NewInt(1002000)) != 0 {
+		log.Printf("[Value Test] Expected a value of 1002000.  Received %v\n", value)
+		t.Fail()
+	}
+
+	filter := &OperationFilter{EnableTx: true, TxDailyMax: big.NewInt(1004001), CostPerByte: big.NewInt(1000)}
+	testKeyPolicy(t, "[Value Test - Cost Per Byte]", filter, nil, testPolicyTransfer(false, 1000000, 1000), false)
+	filter.CostPerByte = nil
+	testKeyPolicy(t, "[Value Test - Protocol Cost Per Byte]", filter, nil, testPolicyTransfer(false, 1000000, 1000), true)
+}
+
+func TestOperationCaps(t *testing.T) {
+	filter := &OperationFilter{EnableGeneric: true, MaxFee: big.NewInt(1000)}
+	testKeyPolicy(t, "[Caps Test - Max Fee]", filter, nil, testPolicyTransfer(false, 1, 1000), true)
+	testKeyPolicy(t, "[Caps Test - Over Max Fee]", filter, nil, testPolicyTransfer(false, 1, 1001), false)
+
+	filter = &OperationFilter{EnableTx: true, MaxGasLimit: big.NewInt(3), MaxStorageLimit: big.NewInt(4)}
+	testKeyPolicy(t, "[Caps Test - Max Limits]", filter, nil, testPolicyTransfer(false, 1, 1), true)
+	filter.MaxGasLimit = big.NewInt(2)
+	testKeyPolicy(t, "[Caps Test - Over Max Gas Limit]", filter, nil, testPolicyTransfer(false, 1, 1), false)
+	filter.MaxGasLimit = nil
+	filter.MaxStorageLimit = big.NewInt(3)
+	testKeyPolicy(t, "[Caps Test - Over Max Storage Limit]", filter, nil, testPolicyTransfer(false, 1, 1), false)
+}
@@ -2,172 +2,813 @@ package signer
 
 import (
 	"encoding/hex"
+	"fmt"
 	"log"
 	"math/big"
 )
 
 // GenericOperation parses an operation with a generic magic byte
 type GenericOperation struct {
-	hex []byte
-}
-
-// Kind of different types of generic operations
-// Defined in gitlb.com/tezos/tezos:
-// https://gitlab.com/tezos/tezos/blob/zeronet/src/proto_005_PsBABY5H/lib_protocol/operation_repr.ml#L548
-const (
-	opKindSeedNonceRevelation  = 0x01
-	opKindDoubleEndorsement    = 0x02
-	opKindDoubleBakingEvidence = 0x04
-	opKindActivateAccount      = 0x04
-	opKindProposal             = 0x05
-	opKindBallot               = 0x06
-	opKindReveal               = 0x6B
-	opKindTransaction          = 0x6C
-	opKindOrigination          = 0x6C
-	opKindDelegation           = 0x6E
-	opKindUnknown              = 0xff
-)
+	hex      []byte
+	branch   string
+	contents []OperationContent
+	err      error
+}
+
+// OperationContent is a single decoded content of a generic operation batch
+type OperationContent interface {
+	Kind() OperationKind
+}
+
+// ManagerOperation holds the fields shared by every manager operation
+type ManagerOperation struct {
+	Source       string   `json:"source"`
+	Fee          *big.Int `json:"fee"`
+	Counter      *big.Int `json:"counter"`
+	GasLimit     *big.Int `json:"gas_limit"`
+	StorageLimit *big.Int `json:"storage_limit"`
+}
+
+// Manager fields of this content
+func (op *ManagerOperation) Manager() *ManagerOperation {
+	return op
+}
+
+// managerContent is implemented by every content carrying a counter
+type managerContent interface {
+	OperationContent
+	Manager() *ManagerOperation
+}
+
+// Reveal the public key of the source
+type Reveal struct {
+	ManagerOperation
+	PublicKey string `json:"public_key"`
+}
+
+// Kind of a reveal
+func (op *Reveal) Kind() OperationKind { return opKindReveal }
+
+// Transaction of tez, possibly calling a contract
+type Transaction struct {
+	ManagerOperation
+	Amount      *big.Int               `json:"amount"`
+	Destination string                 `json:"destination"`
+	Parameters  *TransactionParameters `json:"parameters,omitempty"`
+}
+
+// Kind of a transaction
+func (op *Transaction) Kind() OperationKind { return opKindTransaction }
+
+// TransactionParameters passed to the entrypoint of a contract
+type TransactionParameters struct {
+	Entrypoint string     `json:"entrypoint"`
+	Value      *Micheline `json:"value"`
+}
+
+// Delegation of the source's balance, or withdrawal if Delegate is empty
+type Delegation struct {
+	ManagerOperation
+	Delegate string `json:"delegate,omitempty"`
+}
+
+// Kind of a delegation
+func (op *Delegation) Kind() OperationKind { return opKindDelegation }
+
+// Ballot for or against the proposal of the current voting period
+type Ballot struct {
+	Source   string `json:"source"`
+	Period   int32  `json:"period"`
+	Proposal string `json:"proposal,omitempty"`
+	Ballot   uint8  `json:"ballot"`
+}
+
+// Kind of a ballot
+func (op *Ballot) Kind() OperationKind { return opKindBallot }
+
+// Ballot values, in the order of their tags
+var ballotValues = []string{"yay", "nay", "pass"}
+
+// Value of the ballot: yay, nay or pass
+func (op *Ballot) Value() string {
+	if int(op.Ballot) < len(ballotValues) {
+		return ballotValues[op.Ballot]
+	}
+	return fmt.Sprintf("unknown (0x%02x)", op.Ballot)
+}
+
+// Proposals submitted or upvoted during the proposal period
+type Proposals struct {
+	Source    string   `json:"source"`
+	Period    int32    `json:"period"`
+	Proposals []string `json:"proposals"`
+}
+
+// Kind of proposals
+func (op *Proposals) Kind() OperationKind { return opKindProposal }
+
+// ActivateAccount of a fundraiser account
+type ActivateAccount struct {
+	PublicKeyHash string `json:"public_key_hash"`
+	Secret        string `json:"secret"`
+}
+
+// Kind of an account activation
+func (op *ActivateAccount) Kind() OperationKind { return opKindActivateAccount }
+
+// SeedNonceRevelation of a baker's committed nonce
+type SeedNonceRevelation struct {
+	Level int32  `json:"level"`
+	Nonce string `json:"nonce"`
+}
+
+// Kind of a seed nonce revelation
+func (op *SeedNonceRevelation) Kind() OperationKind { return opKindSeedNonceRevelation }
+
+// Origination of a smart contract
+type Origination struct {
+	ManagerOperation
+	Balance  *big.Int `json:"balance"`
+	Delegate string   `json:"delegate,omitempty"`
+	Code     HexBytes `json:"code"`
+	Storage  HexBytes `json:"storage"`
+}
+
+// Kind of an origination
+func (op *Origination) Kind() OperationKind { return opKindOrigination }
+
+// RegisterGlobalConstant Micheline expression
+type RegisterGlobalConstant struct {
+	ManagerOperation
+	Value HexBytes `json:"value"`
+}
+
+// Kind of a global constant registration
+func (op *RegisterGlobalConstant) Kind() OperationKind { return opKindRegisterGlobalConstant }
+
+// SetDepositsLimit of a baker, or remove the limit if Limit is nil
+type SetDepositsLimit struct {
+	ManagerOperation
+	Limit *big.Int `json:"limit"`
+}
+
+// Kind of a deposits limit
+func (op *SetDepositsLimit) Kind() OperationKind { return opKindSetDepositsLimit }
+
+// IncreasePaidStorage of a smart contract
+type IncreasePaidStorage struct {
+	ManagerOperation
+	Amount      *big.Int `json:"amount"`
+	Destination string   `json:"destination"`
+}
+
+// Kind of a paid storage increase
+func (op *IncreasePaidStorage) Kind() OperationKind { return opKindIncreasePaidStorage }
+
+// UpdateConsensusKey of a baker
+type UpdateConsensusKey struct {
+	ManagerOperation
+	PublicKey string `json:"public_key"`
+}
+
+// Kind of a consensus key update
+func (op *UpdateConsensusKey) Kind() OperationKind { return opKindUpdateConsensusKey }
+
+// TransferTicket from an implicit account
+type TransferTicket struct {
+	ManagerOperation
+	TicketContents HexBytes `json:"ticket_contents"`
+	TicketType     HexBytes `json:"ticket_type"`
+	Ticketer       string   `json:"ticketer"`
+	TicketAmount   *big.Int `json:"ticket_amount"`
+	Destination    string   `json:"destination"`
+	Entrypoint     string   `json:"entrypoint"`
+}
+
+// Kind of a ticket transfer
+func (op *TransferTicket) Kind() OperationKind { return opKindTransferTicket }
+
+// DrainDelegate moves a baker's spendable balance using its consensus key
+type DrainDelegate struct {
+	ConsensusKey string `json:"consensus_key"`
+	Delegate     string `json:"delegate,omitempty"`
+	Destination  string `json:"destination"`
+}
+
+// Kind of a delegate drain
+func (op *DrainDelegate) Kind() OperationKind { return opKindDrainDelegate }
+
+// FailingNoop signs arbitrary bytes that can never be included in a block
+type FailingNoop struct {
+	Arbitrary HexBytes `json:"arbitrary"`
+}
+
+// Kind of a failing noop
+func (op *FailingNoop) Kind() OperationKind { return opKindFailingNoop }
+
+// VdfRevelation of the seed's VDF solution
+type VdfRevelation struct {
+	Solution string `json:"solution"`
+}
+
+// Kind of a VDF revelation
+func (op *VdfRevelation) Kind() OperationKind { return opKindVdfRevelation }
+
+// Evidence of a baker double signing, holding both conflicting operations
+// or block headers
+type Evidence struct {
+	kind   OperationKind
+	First  HexBytes `json:"first"`
+	Second HexBytes `json:"second"`
+}
+
+// Kind of evidence
+func (op *Evidence) Kind() OperationKind { return op.kind }
+
+// UndecodedOperation is a content whose kind and length are known but whose
+// body is not decoded.
+type UndecodedOperation struct {
+	kind    OperationKind
+	Manager *ManagerOperation `json:"manager"`
+	Body    HexBytes          `json:"body"`
+}
+
+// Kind of the undecoded operation
+func (op *UndecodedOperation) Kind() OperationKind { return op.kind }
+
+// managerOf a content, or nil if it isn't a manager operation
+func managerOf(content OperationContent) *ManagerOperation {
+	switch content := content.(type) {
+	case managerContent:
+		return content.Manager()
+	case *UndecodedOperation:
+		return content.Manager
+	}
+	return nil
+}
+
+// Readers of the bodies of manager operations that are not decoded, after
+// their manager fields.  Kinds whose length can't be determined, like
+// smart_rollup_refute, are missing so that nothing can hide after them.
+var undecodedManagerBodies = map[OperationKind]func(d *decoder) error{
+	opKindSmartRollupAddMessages: func(d *decoder) error {
+		_, err := d.readVariableBytes()
+		return err
+	},
+	opKindSmartRollupCement: func(d *decoder) error {
+		_, err := d.readBytes(smartRollupAddressLength)
+		return err
+	},
+	opKindSmartRollupPublish: func(d *decoder) error {
+		// Rollup, then the commitment's compressed state, inbox level,
+		// predecessor and number of ticks
+		_, err := d.readBytes(smartRollupAddressLength + 32 + 4 + 32 + 8)
+		return err
+	},
+	opKindSmartRollupTimeout: func(d *decoder) error {
+		if _, err := d.readBytes(smartRollupAddressLength); err != nil {
+			return err
+		}
+		if _, err := d.readPublicKeyHash(); err != nil {
+			return err
+		}
+		_, err := d.readPublicKeyHash()
+		return err
+	},
+	opKindSmartRollupExecuteOutboxMsg: func(d *decoder) error {
+		// Rollup, cemented commitment then the output proof
+		if _, err := d.readBytes(smartRollupAddressLength + 32); err != nil {
+			return err
+		}
+		_, err := d.readVariableBytes()
+		return err
+	},
+	opKindSmartRollupRecoverBond: func(d *decoder) error {
+		if _, err := d.readBytes(smartRollupAddressLength); err != nil {
+			return err
+		}
+		_, err := d.readPublicKeyHash()
+		return err
+	},
+	opKindDalPublishCommitment: func(d *decoder) error {
+		// Slot index, commitment then commitment proof
+		_, err := d.readBytes(1 + 48 + 48)
+		return err
+	},
+}
+
+// Bytes of a smart rollup address
+const smartRollupAddressLength = 20
 
 // GetGenericOperation to parse specific Generic fields
 func GetGenericOperation(op *Operation) *GenericOperation {
 	if op.MagicByte() != opMagicByteGeneric {
 		return nil
 	}
-	return &GenericOperation{
+	generic := &GenericOperation{
 		hex: op.Hex(),
 	}
+	generic.branch, generic.contents, generic.err = decodeGenericOperation(generic.hex[1:])
+	if generic.err != nil {
+		log.Println("[WARN] Unable to decode generic operation:", generic.err)
+	}
+	return generic
 }
 
 // Structure for these methods is documented in:
 // `tezos-client describe unsigned operation`
 
-// Kind of the generic operation
-func (op *GenericOperation) Kind() uint8 {
-	// Must be at least long enough to get the kind byte
-	if len(op.hex) <= 33 {
+// decodeGenericOperation into its branch and every content of the batch
+func decodeGenericOperation(bytes []byte) (string, []OperationContent, error) {
+	d := newDecoder(bytes)
+	branch, err := d.readHash(tzBlockHash, 32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	contents := []OperationContent{}
+	for d.remaining() > 0 {
+		content, err := decodeContent(d)
+		if err != nil {
+			return branch, contents, err
+		}
+		contents = append(contents, content)
+	}
+	if len(contents) == 0 {
+		return branch, contents, fmt.Errorf("operation has no contents")
+	}
+	return branch, contents, nil
+}
+
+// decodeContent reads a single tagged content, identifying its kind with the
+// active protocol
+func decodeContent(d *decoder) (OperationContent, error) {
+	tag, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	kind := activeProtocol.Kind(tag)
+	switch kind {
+	case opKindSeedNonceRevelation:
+		op := &SeedNonceRevelation{}
+		if op.Level, err = d.readInt32(); err != nil {
+			return nil, err
+		}
+		nonce, err := d.readBytes(32)
+		op.Nonce = hex.EncodeToString(nonce)
+		return op, err
+	case opKindVdfRevelation:
+		solution, err := d.readBytes(200)
+		return &VdfRevelation{Solution: hex.EncodeToString(solution)}, err
+	case opKindDoubleEndorsement, opKindDoublePreendorsement, opKindDoubleAttestation, opKindDoublePreattestation, opKindDoubleBakingEvidence:
+		op := &Evidence{kind: kind}
+		if op.First, err = d.readVariableBytes(); err != nil {
+			return nil, err
+		}
+		op.Second, err = d.readVariableBytes()
+		return op, err
+	case opKindActivateAccount:
+		op := &ActivateAccount{}
+		if op.PublicKeyHash, err = d.readHash(tzEd25519PublicKeyHash, 20); err != nil {
+			return nil, err
+		}
+		secret, err := d.readBytes(20)
+		op.Secret = hex.EncodeToString(secret)
+		return op, err
+	case opKindProposal:
+		op := &Proposals{}
+		if op.Source, err = d.readPublicKeyHash(); err != nil {
+			return nil, err
+		}
+		if op.Period, err = d.readInt32(); err != nil {
+			return nil, err
+		}
+		proposals, err := d.readVariableBytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(proposals)%32 != 0 {
+			return nil, fmt.Errorf("proposals are not a list of 32 byte hashes")
+		}
+		proposalDecoder := newDecoder(proposals)
+		for proposalDecoder.remaining() > 0 {
+			proposal, _ := proposalDecoder.readHash(tzProtocolHash, 32)
+			op.Proposals = append(op.Proposals, proposal)
+		}
+		return op, nil
+	case opKindBallot:
+		op := &Ballot{}
+		if op.Source, err = d.readPublicKeyHash(); err != nil {
+			return nil, err
+		}
+		if op.Period, err = d.readInt32(); err != nil {
+			return nil, err
+		}
+		if op.Proposal, err = d.readHash(tzProtocolHash, 32); err != nil {
+			return nil, err
+		}
+		op.Ballot, err = d.readUint8()
+		return op, err
+	case opKindDrainDelegate:
+		op := &DrainDelegate{}
+		if op.ConsensusKey, err = d.readPublicKeyHash(); err != nil {
+			return nil, err
+		}
+		if op.Delegate, err = d.readPublicKeyHash(); err != nil {
+			return nil, err
+		}
+		op.Destination, err = d.readPublicKeyHash()
+		return op, err
+	case opKindFailingNoop:
+		arbitrary, err := d.readVariableBytes()
+		return &FailingNoop{Arbitrary: arbitrary}, err
+	case opKindReveal:
+		op := &Reveal{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		op.PublicKey, err = d.readPublicKey()
+		return op, err
+	case opKindTransaction:
+		op := &Transaction{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		if op.Amount, err = d.readNat(); err != nil {
+			return nil, err
+		}
+		if op.Destination, err = d.readContractID(); err != nil {
+			return nil, err
+		}
+		op.Parameters, err = decodeTransactionParameters(d)
+		return op, err
+	case opKindOrigination:
+		op := &Origination{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		if op.Balance, err = d.readNat(); err != nil {
+			return nil, err
+		}
+		if op.Delegate, err = decodeOptionalPublicKeyHash(d); err != nil {
+			return nil, err
+		}
+		if op.Code, err = d.readVariableBytes(); err != nil {
+			return nil, err
+		}
+		op.Storage, err = d.readVariableBytes()
+		return op, err
+	case opKindDelegation:
+		op := &Delegation{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		op.Delegate, err = decodeOptionalPublicKeyHash(d)
+		return op, err
+	case opKindRegisterGlobalConstant:
+		op := &RegisterGlobalConstant{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		op.Value, err = d.readVariableBytes()
+		return op, err
+	case opKindSetDepositsLimit:
+		op := &SetDepositsLimit{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		hasLimit, err := d.readBool()
+		if err != nil || !hasLimit {
+			return op, err
+		}
+		op.Limit, err = d.readNat()
+		return op, err
+	case opKindIncreasePaidStorage:
+		op := &IncreasePaidStorage{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		if op.Amount, err = d.readInt(); err != nil {
+			return nil, err
+		}
+		// A negative amount would lower the value of the batch
+		if op.Amount.Sign() < 0 {
+			return nil, fmt.Errorf("negative paid storage amount %v at offset %v", op.Amount, d.offset)
+		}
+		// The destination is an originated contract_id: 0x01, the hash, then padding
+		tag, err := d.readUint8()
+		if err != nil {
+			return nil, err
+		}
+		if tag != 0x01 {
+			return nil, fmt.Errorf("paid storage destination isn't an originated contract, tag 0x%02x at offset %v", tag, d.offset-1)
+		}
+		if op.Destination, err = d.readHash(tzContractHash, 20); err != nil {
+			return nil, err
+		}
+		_, err = d.readBytes(1)
+		return op, err
+	case opKindUpdateConsensusKey:
+		op := &UpdateConsensusKey{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		op.PublicKey, err = d.readPublicKey()
+		return op, err
+	case opKindTransferTicket:
+		op := &TransferTicket{}
+		if err = decodeManagerOperation(d, &op.ManagerOperation); err != nil {
+			return nil, err
+		}
+		if op.TicketContents, err = d.readVariableBytes(); err != nil {
+			return nil, err
+		}
+		if op.TicketType, err = d.readVariableBytes(); err != nil {
+			return nil, err
+		}
+		if op.Ticketer, err = d.readContractID(); err != nil {
+			return nil, err
+		}
+		if op.TicketAmount, err = d.readNat(); err != nil {
+			return nil, err
+		}
+		if op.Destination, err = d.readContractID(); err != nil {
+			return nil, err
+		}
+		entrypoint, err := d.readVariableBytes()
+		op.Entrypoint = string(entrypoint)
+		return op, err
+	case opKindUnknown:
+		return nil, fmt.Errorf("unknown operation tag 0x%02x at offset %v for protocol %v", tag, d.offset-1, activeProtocol.Name)
+	default:
+		// Keep the kind, reading the body only if its length is known
+		readBody, ok := undecodedManagerBodies[kind]
+		if !ok {
+			return nil, fmt.Errorf("unable to decode the length of %v at offset %v", kind, d.offset-1)
+		}
+		op := &UndecodedOperation{kind: kind, Manager: &ManagerOperation{}}
+		if err = decodeManagerOperation(d, op.Manager); err != nil {
+			return nil, err
+		}
+		start := d.offset
+		if err = readBody(d); err != nil {
+			return nil, err
+		}
+		op.Body = d.bytes[start:d.offset]
+		return op, nil
+	}
+}
+
+// decodeOptionalPublicKeyHash reads an address that may be omitted
+func decodeOptionalPublicKeyHash(d *decoder) (string, error) {
+	present, err := d.readBool()
+	if err != nil || !present {
+		return "", err
+	}
+	return d.readPublicKeyHash()
+}
+
+// decodeManagerOperation reads the fields shared by every manager operation
+func decodeManagerOperation(d *decoder, op *ManagerOperation) error {
+	var err error
+	if op.Source, err = d.readPublicKeyHash(); err != nil {
+		return err
+	}
+	if op.Fee, err = d.readNat(); err != nil {
+		return err
+	}
+	if op.Counter, err = d.readNat(); err != nil {
+		return err
+	}
+	if op.GasLimit, err = d.readNat(); err != nil {
+		return err
+	}
+	op.StorageLimit, err = d.readNat()
+	return err
+}
+
+// Entrypoints with a reserved tag.  Any other entrypoint is named explicitly.
+var entrypointTags = map[uint8]string{
+	0x00: "default",
+	0x01: "root",
+	0x02: "do",
+	0x03: "set_delegate",
+	0x04: "remove_delegate",
+	0x05: "deposit",
+	0x06: "stake",
+	0x07: "unstake",
+	0x08: "finalize_unstake",
+	0x09: "set_delegate_parameters",
+}
+
+// decodeTransactionParameters reads the optional parameters of a transaction
+func decodeTransactionParameters(d *decoder) (*TransactionParameters, error) {
+	hasParameters, err := d.readBool()
+	if err != nil || !hasParameters {
+		return nil, err
+	}
+
+	params := &TransactionParameters{}
+	tag, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+	if tag == 0xff {
+		length, err := d.readUint8()
+		if err != nil {
+			return nil, err
+		}
+		name, err := d.readBytes(int(length))
+		if err != nil {
+			return nil, err
+		}
+		params.Entrypoint = string(name)
+	} else if name, ok := entrypointTags[tag]; ok {
+		params.Entrypoint = name
+	} else {
+		return nil, fmt.Errorf("unknown entrypoint tag 0x%02x", tag)
+	}
+
+	value, err := d.readVariableBytes()
+	if err != nil {
+		return nil, err
+	}
+	params.Value, err = decodeMichelineBytes(value)
+	return params, err
+}
+
+// Branch the operation was forged on
+func (op *GenericOperation) Branch() string {
+	return op.branch
+}
+
+// Contents of the operation batch.  Returns an error if any content could
+// not be decoded.
+func (op *GenericOperation) Contents() ([]OperationContent, error) {
+	return op.contents, op.err
+}
+
+// Kind of the generic operation, or of its first content in a batch
+func (op *GenericOperation) Kind() OperationKind {
+	if len(op.contents) == 0 {
 		return opKindUnknown
 	}
+	return op.contents[0].Kind()
+}
+
+// Source of the manager operations in this batch, which the protocol requires
+// to all be the same
+func (op *GenericOperation) Source() string {
+	for _, content := range op.contents {
+		if manager := managerOf(content); manager != nil {
+			return manager.Source
+		}
+	}
+	return ""
+}
+
+// Counter is the highest counter of the manager operations in this batch, or
+// nil if there are none
+func (op *GenericOperation) Counter() *big.Int {
+	_, highest := op.Counters()
+	return highest
+}
+
+// Counters are the lowest and highest counters of the manager operations in
+// this batch, or nil if there are none
+func (op *GenericOperation) Counters() (*big.Int, *big.Int) {
+	var lowest, highest *big.Int
+	for _, content := range op.contents {
+		if manager := managerOf(content); manager != nil {
+			if lowest == nil || manager.Counter.Cmp(lowest) == -1 {
+				lowest = manager.Counter
+			}
+			if highest == nil || manager.Counter.Cmp(highest) == 1 {
+				highest = manager.Counter
+			}
+		}
+	}
+	return lowest, highest
+}
 
-	return op.hex[33]
+// transaction is the first transaction in the batch
+func (op *GenericOperation) transaction() *Transaction {
+	for _, content := range op.contents {
+		if tx, ok := content.(*Transaction); ok {
+			return tx
+		}
+	}
+	return nil
 }
 
 // TransactionSource address that funds are being moved from
 func (op *GenericOperation) TransactionSource() string {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return ""
 	}
-	return hex.EncodeToString(op.hex[34:55])
+	return PubkeyHashToByteString(tx.Source)
 }
 
 // TransactionFee that's being paid along with this tx
 func (op *GenericOperation) TransactionFee() *big.Int {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return nil
 	}
-	return op.parseSerializedNumberOffset(0)
+	return tx.Fee
 }
 
 // TransactionCounter ensuring idempotency of this tx
 func (op *GenericOperation) TransactionCounter() *big.Int {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return nil
 	}
-	return op.parseSerializedNumberOffset(1)
+	return tx.Counter
 }
 
 // TransactionGasLimit of this tx
 func (op *GenericOperation) TransactionGasLimit() *big.Int {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return nil
 	}
-	return op.parseSerializedNumberOffset(2)
+	return tx.GasLimit
 }
 
 // TransactionStorageLimit of this tx
 func (op *GenericOperation) TransactionStorageLimit() *big.Int {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return nil
 	}
-	return op.parseSerializedNumberOffset(3)
+	return tx.StorageLimit
 }
 
 // TransactionAmount that's moving with this tx
 func (op *GenericOperation) TransactionAmount() *big.Int {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return nil
 	}
-	return op.parseSerializedNumberOffset(4)
+	return tx.Amount
 }
 
 // TransactionDestination address we're sending funds to
 func (op *GenericOperation) TransactionDestination() string {
-	if op.Kind() != opKindTransaction {
+	tx := op.transaction()
+	if tx == nil {
 		return ""
 	}
-	// Verify these indices align with the end_index of transaction amount
-	numberIndex := 55
-	for i := 0; i <= 4; i++ {
-		_, numberIndex = op.parseSerializedNumber(numberIndex)
-	}
-
-	destinationStart := numberIndex + 1
-	destinationEnd := numberIndex + 22
+	return PubkeyHashToByteString(tx.Destination)
+}
 
-	// Verify that no extra bytes are packed in here
-	if destinationEnd != len(op.hex)-1 {
-		log.Println("[WARN] Incorrect offset between numbers and destination. Unexpected parameters present. Unsure where we're sending.")
-		return ""
-	}
-	// Verify that there are no trailing parameters
-	if op.hex[len(op.hex)-1] != 0x00 {
-		log.Println("[WARN] Presence of field parameters is not false, but parameter parsing is not yet implemented.  Failing.")
-		return ""
+// TransactionParameters of a contract call, or nil for plain transfers
+func (op *GenericOperation) TransactionParameters() *TransactionParameters {
+	tx := op.transaction()
+	if tx == nil {
+		return nil
 	}
-	return hex.EncodeToString(op.hex[destinationStart:destinationEnd])
+	return tx.Parameters
 }
 
-// TransactionValue is the total value of all XTZ that could be spent in this tx
+// TransactionValue is the total value of all XTZ that could be spent by the
+// batch, burning storage at the active protocol's cost per byte
 func (op *GenericOperation) TransactionValue() *big.Int {
-	if op.Kind() != opKindTransaction {
+	return op.valueAt(big.NewInt(activeProtocol.CostPerByte))
+}
+
+// valueAt the cost per byte of storage, or nil if the batch can't be decoded
+func (op *GenericOperation) valueAt(costPerByte *big.Int) *big.Int {
+	contents, err := op.Contents()
+	if err != nil {
 		return nil
 	}
 	total := &big.Int{}
-	total.Add(total, op.TransactionFee())
-	total.Add(total, op.TransactionAmount())
-	total.Add(total, op.TransactionGasLimit())
-	total.Add(total, op.TransactionStorageLimit())
-	return total
-}
-
-// Private funcs to parse sequentially serialized numbers in the operation's hex
-func (op *GenericOperation) parseSerializedNumberOffset(offset int) *big.Int {
-	num := new(big.Int).SetInt64(int64(0))
-	// Numbers always begin at this index
-	index := 55
-	for i := 0; i <= offset; i++ {
-		num, index = op.parseSerializedNumber(index)
+	for _, content := range contents {
+		total.Add(total, contentValue(content, costPerByte))
 	}
-	return num
+	return total
 }
 
-// Parse a numbers starting at the provided index.  Return the number and
-// the index of the next byte in the operation.  Follows the recursive reading
-// fn @ https://gitlab.com/tezos/tezos/blob/master/src/lib_data_encoding/binary_reader.ml#L174
-func (op *GenericOperation) parseSerializedNumber(startIndex int) (*big.Int, int) {
-	if len(op.hex) <= startIndex {
-		log.Println("[WARN] Ran into end of bytes while parsing.  Returning zero.")
-		return new(big.Int).SetInt64(0), startIndex
+// contentValue of XTZ the content could spend: the amount it moves, its fee
+// and the storage it may burn.  Gas is paid for by the fee.
+func contentValue(content OperationContent, costPerByte *big.Int) *big.Int {
+	total := &big.Int{}
+	if manager := managerOf(content); manager != nil {
+		total.Add(total, manager.Fee)
+		total.Add(total, new(big.Int).Mul(manager.StorageLimit, costPerByte))
 	}
-	b := op.hex[startIndex]
-	nextIndex := startIndex + 1
-
-	base := new(big.Int).SetInt64(int64(0))
-	top := new(big.Int).SetInt64(int64(b))
-	top.Mod(top, new(big.Int).SetInt64(0x80))
-	if b >= 0x80 {
-		var result *big.Int
-		result, nextIndex = op.parseSerializedNumber(nextIndex)
-		base.Mul(new(big.Int).SetInt64(0x80), result)
+	switch c := content.(type) {
+	case *Transaction:
+		total.Add(total, c.Amount)
+	case *Origination:
+		total.Add(total, c.Balance)
+	case *IncreasePaidStorage:
+		// Paid storage is bought in bytes
+		total.Add(total, new(big.Int).Mul(c.Amount, costPerByte))
 	}
-	return top.Add(top, base), nextIndex
+	return total
 }
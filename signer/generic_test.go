@@ -2,15 +2,17 @@ package signer
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"log"
 	"math/big"
+	"strings"
 	"testing"
 )
 
 type testGenericOperation struct {
 	Name         string
 	Operation    string
-	Kind         uint8
+	Kind         OperationKind
 	Source       string
 	Fee          *big.Int
 	Counter      *big.Int
@@ -169,11 +171,9 @@ func TestParseBallot(t *testing.T) {
 }
 
 func testParseBytes(t *testing.T, bytes string, expect int64) {
-	var op GenericOperation
 	hex, _ := hex.DecodeString(bytes)
-	op = GenericOperation{hex: hex}
 
-	num, _ := op.parseSerializedNumber(0)
+	num, _ := newDecoder(hex).readNat()
 	if num.Int64() != expect {
 		log.Printf("Expecting %v, received %v\n", expect, num.String())
 		t.Fail()
@@ -196,3 +196,147 @@ func TestParseBytes(t *testing.T) {
 	testParseBytes(t, "ffff03", 65535)
 	testParseBytes(t, "808004", 65536)
 }
+
+func TestByteStringToPubkeyHash(t *testing.T) {
+	for _, pkh := range []string{"tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf", "tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m", "tz3bh5VbXnLMyHGUMfhRKYzVXQE1axzTm9FN"} {
+		if ByteStringToPubkeyHash(PubkeyHashToByteString(pkh)) != pkh {
+			log.Printf("Expecting %v, received %v\n", pkh, ByteStringToPubkeyHash(PubkeyHashToByteString(pkh)))
+			t.Fail()
+		}
+	}
+}
+
+// A reveal followed by two transfers from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m
+const testBatch = "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+	"6b0154f5d8f71ce18f9f05bb885a4120e64c667bc1b40102030401" + "02" + "1111111111111111111111111111111111111111111111111111111111111111" +
+	"6c0154f5d8f71ce18f9f05bb885a4120e64c667bc1b4010303040500008c947bf65254cf1a813eb8c6d3f980a89751e2af00" +
+	"6c0154f5d8f71ce18f9f05bb885a4120e64c667bc1b40104030406016e7c23cc06c7b0743256f65e34d5b0f7c91e4eb20000\""
+
+func TestParseBatch(t *testing.T) {
+	op, _ := ParseOperation([]byte(testBatch))
+	generic := GetGenericOperation(op)
+	contents, err := generic.Contents()
+	if err != nil || len(contents) != 3 {
+		log.Printf("[Batch Test] Expected 3 contents, received %v: %v\n", len(contents), err)
+		t.FailNow()
+	}
+
+	reveal, ok := contents[0].(*Reveal)
+	if !ok || reveal.Source != "tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m" || reveal.Counter.Int64() != 2 {
+		log.Printf("[Batch Test] First content should be a reveal from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m: %+v\n", contents[0])
+		t.Fail()
+	}
+	tx, ok := contents[1].(*Transaction)
+	if !ok || tx.Destination != "tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf" || tx.Amount.Int64() != 5 {
+		log.Printf("[Batch Test] Second content should be a transfer of 5 to tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf: %+v\n", contents[1])
+		t.Fail()
+	}
+	tx, ok = contents[2].(*Transaction)
+	if !ok || tx.Destination != "KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp" || tx.Amount.Int64() != 6 {
+		log.Printf("[Batch Test] Third content should be a transfer of 6 to KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp: %+v\n", contents[2])
+		t.Fail()
+	}
+	if generic.Counter().Int64() != 4 {
+		log.Printf("[Batch Test] Expected the highest counter to be 4, received %v\n", generic.Counter())
+		t.Fail()
+	}
+
+	// A batch is only allowed if every content is
+	filter := OperationFilter{EnableTx: true}
+	if filter.IsAllowed(op) {
+		log.Println("[Batch Test] A reveal should not be allowed when only transactions are enabled")
+		t.Fail()
+	}
+	filter = OperationFilter{EnableGeneric: true}
+	if !filter.IsAllowed(op) {
+		log.Println("[Batch Test] Any batch should be allowed when generic operations are enabled")
+		t.Fail()
+	}
+}
+
+func TestParseTruncatedBatch(t *testing.T) {
+	op, _ := ParseOperation([]byte(testBatch[:len(testBatch)-11] + "\""))
+	if _, err := GetGenericOperation(op).Contents(); err == nil {
+		log.Println("[Batch Test] A truncated batch should fail to decode")
+		t.Fail()
+	}
+}
+
+func TestParseUndecodedBatch(t *testing.T) {
+	// smart_rollup_add_messages of one message, then a transfer of 5
+	messages := "00000005" + "00000001" + "aa"
+	transfer := "6c" + testBakerSource + "01030304" + "05" + "00" + testBakerTz1 + "00"
+	op, _ := ParseOperation([]byte(testBakerOperation("c9", messages+transfer)))
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil || len(contents) != 2 || contents[0].Kind() != opKindSmartRollupAddMessages || contents[1].Kind() != opKindTransaction {
+		log.Printf("[Batch Test] Expected the transfer after the messages to be decoded, received %v: %v\n", contents, err)
+		t.Fail()
+	}
+
+	// The length of a refutation isn't known, so it can't be decoded
+	op, _ = ParseOperation([]byte(testBakerOperation("cc", "00")))
+	if _, err := GetGenericOperation(op).Contents(); err == nil {
+		log.Println("[Batch Test] A smart_rollup_refute should fail to decode")
+		t.Fail()
+	}
+}
+
+// testPaidStorage is an increase_paid_storage of 5 bytes of
+// KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp, then a transfer of 5 to
+// tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf
+const testPaidStorage = "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+	"710154f5d8f71ce18f9f05bb885a4120e64c667bc1b401020304" + "05" + "016e7c23cc06c7b0743256f65e34d5b0f7c91e4eb200" +
+	"6c0154f5d8f71ce18f9f05bb885a4120e64c667bc1b4010303040500008c947bf65254cf1a813eb8c6d3f980a89751e2af00\""
+
+func TestParsePaidStorage(t *testing.T) {
+	op, _ := ParseOperation([]byte(testPaidStorage))
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil || len(contents) != 2 {
+		log.Printf("[Paid Storage Test] Expected 2 contents, received %v: %v\n", contents, err)
+		t.FailNow()
+	}
+	paid, ok := contents[0].(*IncreasePaidStorage)
+	if !ok || paid.Amount.Int64() != 5 || paid.Destination != "KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp" {
+		log.Printf("[Paid Storage Test] Expected an increase of 5 bytes of KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp, received %+v\n", contents[0])
+		t.Fail()
+	}
+	tx, ok := contents[1].(*Transaction)
+	if !ok || tx.Destination != "tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf" || tx.Amount.Int64() != 5 {
+		log.Printf("[Paid Storage Test] Expected the transfer after it to be decoded, received %+v\n", contents[1])
+		t.Fail()
+	}
+
+	// Implicit accounts have no paid storage
+	op, _ = ParseOperation([]byte(testBakerOperation("71", "05"+testBakerTz1)))
+	if _, err := GetGenericOperation(op).Contents(); err == nil {
+		log.Println("[Paid Storage Test] An implicit destination should fail to decode")
+		t.Fail()
+	}
+
+	// -5 would lower the value of the batch
+	op, _ = ParseOperation([]byte(testBakerOperation("71", "45"+"016e7c23cc06c7b0743256f65e34d5b0f7c91e4eb200")))
+	if _, err := GetGenericOperation(op).Contents(); err == nil {
+		log.Println("[Paid Storage Test] A negative amount should fail to decode")
+		t.Fail()
+	}
+}
+
+func FuzzDecodeGenericOperation(f *testing.F) {
+	for _, operation := range []string{testSecp256k1Tx.Operation, testP256Tx.Operation, testBatch} {
+		bytes, _ := hex.DecodeString(strings.Trim(operation, "\""))
+		f.Add(bytes[1:])
+	}
+	f.Fuzz(func(t *testing.T, bytes []byte) {
+		_, contents, err := decodeGenericOperation(bytes)
+		if err != nil {
+			return
+		}
+		for _, content := range contents {
+			managerOf(content)
+			if tx, ok := content.(*Transaction); ok && tx.Parameters != nil {
+				json.Marshal(tx.Parameters.Value)
+				tokenTransfers(tx)
+			}
+		}
+	})
+}
@@ -3,7 +3,9 @@ package signer
 import (
 	"io/ioutil"
 	"log"
+	"math/big"
 	"strings"
+	"sync"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -15,6 +17,33 @@ type Key struct {
 	PublicKey     string `yaml:"PublicKey"`
 	HsmSlot       uint   `yaml:"HsmSlot"`
 	HsmLabel      string `yaml:"HsmLabel"`
+
+	// PackedData enables signing Michelson packed data with this key
+	PackedData *PackedDataPolicy `yaml:"PackedData"`
+	// Policy restricts what this key signs, replacing the global flags
+	Policy *KeyPolicy `yaml:"Policy"`
+}
+
+// KeyPolicy of a single key.  Restrictions that aren't set fall back to the
+// global flags.  Setting Kinds replaces --enable-generic, --enable-tx and
+// --enable-voting for this key.  A key with its own DailyMax has its own
+// ledger account, otherwise it shares the global one.
+type KeyPolicy struct {
+	MagicBytes         []uint8         `yaml:"MagicBytes"`
+	Kinds              []OperationKind `yaml:"Kinds"`
+	WhitelistAddresses []string        `yaml:"WhitelistAddresses"`
+	DailyMax           string          `yaml:"DailyMax"`
+	Chains             []string        `yaml:"Chains"`
+	Proposals          []string        `yaml:"Proposals"`
+	Ballots            []string        `yaml:"Ballots"`
+	// AllowUndecoded contents, like smart rollup operations, of allowed kinds
+	AllowUndecoded bool `yaml:"AllowUndecoded"`
+
+	// DailyMax in uXTZ
+	dailyMax *big.Int
+	// Filter derived from the global one on first use
+	once   sync.Once
+	filter *OperationFilter
 }
 
 // Curve represented by this key
@@ -46,5 +75,57 @@ func LoadKeyFile(keyfile string) []Key {
 	if err != nil {
 		log.Fatalln("Unable to parse yaml file: " + keyfile)
 	}
+	for _, key := range keys {
+		if key.PackedData != nil {
+			key.PackedData.parseShapes()
+		}
+		if key.Policy != nil && len(key.Policy.DailyMax) > 0 {
+			var ok bool
+			key.Policy.dailyMax, ok = new(big.Int).SetString(key.Policy.DailyMax, 10)
+			if !ok {
+				log.Fatalf("Invalid DailyMax for key %v: %v\n", key.Name, key.Policy.DailyMax)
+			}
+			key.Policy.dailyMax.Mul(key.Policy.dailyMax, new(big.Int).SetInt64(1000000))
+		}
+		if key.Policy != nil {
+			if err := CheckBallotValues(key.Policy.Ballots); err != nil {
+				log.Fatalf("Invalid Ballots for key %v: %v\n", key.Name, err)
+			}
+		}
+	}
 	return keys
 }
+
+// filterFrom the global filter, overriding the restrictions set by the
+// policy of the key
+func (policy *KeyPolicy) filterFrom(global *OperationFilter, key *Key) *OperationFilter {
+	policy.once.Do(func() {
+		filter := *global
+		if policy.MagicBytes != nil {
+			filter.MagicBytes = policy.MagicBytes
+		}
+		if policy.Chains != nil {
+			filter.Chains = policy.Chains
+		}
+		if policy.Kinds != nil {
+			filter.EnableGeneric = false
+			filter.Kinds = policy.Kinds
+		}
+		if policy.WhitelistAddresses != nil {
+			filter.TxWhitelistAddresses = policy.WhitelistAddresses
+		}
+		if policy.Proposals != nil {
+			filter.VotingProposals = policy.Proposals
+		}
+		if policy.Ballots != nil {
+			filter.VotingBallots = policy.Ballots
+		}
+		filter.AllowUndecoded = policy.AllowUndecoded
+		if policy.dailyMax != nil {
+			filter.TxDailyMax = policy.dailyMax
+			filter.txAccount = "key:" + key.PublicKeyHash
+		}
+		policy.filter = &filter
+	})
+	return policy.filter
+}
@@ -0,0 +1,106 @@
+package signer
+
+import (
+	"log"
+	"math/big"
+	"net/http"
+	"testing"
+)
+
+func testKeyPolicy(t *testing.T, name string, filter *OperationFilter, key *Key, operation string, expected bool) {
+	op, err := ParseOperation([]byte(operation))
+	if err != nil {
+		log.Printf("%v: Unable to parse operation: %v\n", name, err)
+		t.Fail()
+		return
+	}
+	if filter.IsAllowedForKey(op, key) != expected {
+		log.Printf("%v: Expected allowed to be %v\n", name, expected)
+		t.Fail()
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	filter := &OperationFilter{}
+	key := &Key{Name: "test", Policy: &KeyPolicy{
+		Kinds: []OperationKind{opKindTransaction},
+	}}
+
+	testKeyPolicy(t, "Global Tx", filter, nil, testSecp256k1Tx.Operation, false)
+	testKeyPolicy(t, "Key Kinds", filter, key, testSecp256k1Tx.Operation, true)
+	testKeyPolicy(t, "Key Endorsement", filter, key, testEndorse.Operation, true)
+
+	key = &Key{Name: "test", Policy: &KeyPolicy{
+		MagicBytes: []uint8{opMagicByteGeneric},
+		Kinds:      []OperationKind{opKindBallot},
+	}}
+	testKeyPolicy(t, "Key Magic Bytes", filter, key, testEndorse.Operation, false)
+	testKeyPolicy(t, "Key Kinds Exclude Tx", filter, key, testSecp256k1Tx.Operation, false)
+
+	key = &Key{Name: "test", Policy: &KeyPolicy{Chains: []string{testEndorse.ChainID}}}
+	testKeyPolicy(t, "Key Chain", filter, key, testEndorse.Operation, true)
+	key = &Key{Name: "test", Policy: &KeyPolicy{Chains: []string{"NetXe8DbhW9A1eS"}}}
+	testKeyPolicy(t, "Key Other Chain", filter, key, testEndorse.Operation, false)
+
+	key = &Key{Name: "test", Policy: &KeyPolicy{
+		Kinds:              []OperationKind{opKindTransaction},
+		WhitelistAddresses: []string{"tz1VSUr8wwNhLAzempoch5d6hLRiTh8Cjcjb"},
+	}}
+	testKeyPolicy(t, "Key Whitelist", filter, key, testSecp256k1Tx.Operation, false)
+}
+
+func TestKeyPolicyDailyMax(t *testing.T) {
+	filter := &OperationFilter{EnableTx: true, TxDailyMax: new(big.Int).SetInt64(1500000)}
+	key := &Key{Name: "test", Policy: &KeyPolicy{dailyMax: new(big.Int).SetInt64(2500000)}}
+	shared := &Key{Name: "shared", Policy: &KeyPolicy{}}
+
+	// Keys with their own daily max count separately from the global one
+	testKeyPolicy(t, "Global Daily Max #1", filter, nil, testSecp256k1Tx.Operation, true)
+	testKeyPolicy(t, "Key Daily Max #1", filter, key, testSecp256k1Tx.Operation, true)
+	testKeyPolicy(t, "Key Daily Max #2", filter, key, testSecp256k1Tx.Operation, true)
+	testKeyPolicy(t, "Key Daily Max #3", filter, key, testSecp256k1Tx.Operation, false)
+	// Others share the global counter
+	testKeyPolicy(t, "Shared Daily Max", filter, shared, testSecp256k1Tx.Operation, false)
+}
+
+func TestPostKeyPolicy(t *testing.T) {
+	server := getTestServer("tz123")
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	compare(t, "Tx Without Key Policy", resp.StatusCode, http.StatusForbidden, body, testSecp256k1Tx.SignerResponse)
+
+	server.keys[0].Policy = &KeyPolicy{Kinds: []OperationKind{opKindTransaction}}
+	_, description := testDescribe(t, server, testSecp256k1Tx.Operation)
+	if description.Allowed {
+		log.Println("Describe Without Key: Expected the global filter to block the transfer")
+		t.Fail()
+	}
+	_, description = testDescribePath(t, server, "/describe?key="+server.keys[0].PublicKeyHash, testSecp256k1Tx.Operation)
+	if !description.Allowed {
+		log.Println("Describe With Key: Expected the key policy to allow the transfer")
+		t.Fail()
+	}
+	resp, _ = testDescribePath(t, server, "/describe?key=tz1unknown", testSecp256k1Tx.Operation)
+	if resp.StatusCode != http.StatusNotFound {
+		log.Printf("Describe Unknown Key: Expected status code 404.  Received %v\n", resp.StatusCode)
+		t.Fail()
+	}
+	resp, body = testPost(t, server, testSecp256k1Tx)
+	compare(t, "Tx With Key Policy", resp.StatusCode, http.StatusOK, body, testSecp256k1Tx.SignerResponse)
+}
+
+func TestKeyPolicyUndecoded(t *testing.T) {
+	messages := testBakerOperation("c9", "00000005"+"00000001"+"aa")
+	filter := &OperationFilter{}
+	key := &Key{Name: "test", Policy: &KeyPolicy{Kinds: []OperationKind{opKindSmartRollupAddMessages}}}
+	testKeyPolicy(t, "Key Undecoded Kind", filter, key, messages, false)
+	key = &Key{Name: "test", Policy: &KeyPolicy{Kinds: []OperationKind{opKindSmartRollupAddMessages}, AllowUndecoded: true}}
+	testKeyPolicy(t, "Key Allow Undecoded", filter, key, messages, true)
+
+	// Their fees count towards caps
+	filter = &OperationFilter{MaxFee: new(big.Int)}
+	key = &Key{Name: "test", Policy: &KeyPolicy{Kinds: []OperationKind{opKindSmartRollupAddMessages}, AllowUndecoded: true}}
+	testKeyPolicy(t, "Key Undecoded Max Fee", filter, key, messages, false)
+
+	filter = &OperationFilter{PolicyRules: []*PolicyRule{{Name: "rollups", Action: policyActionAllow, Kinds: []OperationKind{opKindSmartRollupAddMessages}}}}
+	testKeyPolicy(t, "Policy File Undecoded Kind", filter, nil, messages, false)
+}
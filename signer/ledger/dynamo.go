@@ -0,0 +1,171 @@
+package ledger
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Attempts to reserve while other replicas reserve for the same account
+const dynamoReserveAttempts = 5
+
+// DynamoLedger records spends in a DynamoDB table shared by replicas.  The
+// table has the partition key "Account" (string) and the sort key "SpentAt"
+// (number, in nanoseconds).  Enable TTL on "Expires" to prune old entries.
+type DynamoLedger struct {
+	table    string
+	dynamodb *dynamodb.DynamoDB
+}
+
+// GetDynamoLedger returns a new dynamo ledger
+func GetDynamoLedger(table string) *DynamoLedger {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_DEFAULT_REGION")),
+	})
+	if err != nil {
+		log.Fatal("Unable to initialize dynamo ledger")
+	}
+
+	return &DynamoLedger{
+		table:    table,
+		dynamodb: dynamodb.New(sess),
+	}
+}
+
+// Spent returns the total recorded for the account since the time
+func (l *DynamoLedger) Spent(account string, since time.Time) (*big.Int, error) {
+	total := new(big.Int)
+	var parseErr error
+	err := l.dynamodb.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(l.table),
+		KeyConditionExpression: aws.String("Account = :account AND SpentAt >= :since"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":account": {S: aws.String(account)},
+			":since":   {N: aws.String(strconv.FormatInt(since.UnixNano(), 10))},
+		},
+		ConsistentRead: aws.Bool(true),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if item["Amount"] == nil || item["Amount"].S == nil {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(*item["Amount"].S, 10)
+			if !ok {
+				parseErr = fmt.Errorf("invalid ledger amount: %v", *item["Amount"].S)
+				return false
+			}
+			total.Add(total, amount)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return total, nil
+}
+
+// version of the account's spends, bumped by every reservation so that
+// replicas can't both reserve against the same total.  It's kept in an item
+// with SpentAt 0, outside of every window.
+func (l *DynamoLedger) version(account string) (string, error) {
+	output, err := l.dynamodb.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Account": {S: aws.String(account)},
+			"SpentAt": {N: aws.String("0")},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if output.Item == nil || output.Item["Version"] == nil || output.Item["Version"].N == nil {
+		return "0", nil
+	}
+	return *output.Item["Version"].N, nil
+}
+
+// Reserve an amount spent by the account at the time unless the total would
+// reach max.  The spend is recorded along with a conditional update of the
+// account's version, which fails if another replica reserved since the total
+// was read.
+func (l *DynamoLedger) Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error) {
+	for attempt := 0; attempt < dynamoReserveAttempts; attempt++ {
+		version, err := l.version(account)
+		if err != nil {
+			return nil, false, err
+		}
+		total, err := l.Spent(account, at.Add(-Window))
+		if err != nil {
+			return nil, false, err
+		}
+		total.Add(total, amount)
+		if total.Cmp(max) != -1 {
+			return total, false, nil
+		}
+
+		_, err = l.dynamodb.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Update: &dynamodb.Update{
+					TableName: aws.String(l.table),
+					Key: map[string]*dynamodb.AttributeValue{
+						"Account": {S: aws.String(account)},
+						"SpentAt": {N: aws.String("0")},
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":version": {N: aws.String(version)},
+						":one":     {N: aws.String("1")},
+					},
+					UpdateExpression:    aws.String("SET Version = :version + :one"),
+					ConditionExpression: aws.String("attribute_not_exists(Version) OR Version = :version"),
+				}},
+				{Put: &dynamodb.Put{
+					TableName: aws.String(l.table),
+					Item: map[string]*dynamodb.AttributeValue{
+						"Account": {S: aws.String(account)},
+						"SpentAt": {N: aws.String(strconv.FormatInt(at.UnixNano(), 10))},
+						"Amount":  {S: aws.String(amount.String())},
+						"Expires": {N: aws.String(strconv.FormatInt(at.Add(Window).Unix(), 10))},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(SpentAt)"),
+				}},
+			},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			// Another replica reserved first, so read the new total
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return total, true, nil
+	}
+	return nil, false, fmt.Errorf("too many concurrent reservations for %v", account)
+}
+
+// Release an amount reserved by the account at the time
+func (l *DynamoLedger) Release(account string, at time.Time, amount *big.Int) error {
+	_, err := l.dynamodb.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Account": {S: aws.String(account)},
+			"SpentAt": {N: aws.String(strconv.FormatInt(at.UnixNano(), 10))},
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":amount": {S: aws.String(amount.String())},
+		},
+		ConditionExpression: aws.String("Amount = :amount"),
+	})
+	return err
+}
@@ -0,0 +1,103 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileLedger records spends in a local file.  Replicas each need their own.
+type FileLedger struct {
+	file    string
+	entries []*Entry
+	mux     sync.Mutex
+}
+
+// GetFileLedger returns a new file ledger
+func GetFileLedger(file string) *FileLedger {
+	// If file is not set, create a new file in our home directory
+	if len(file) == 0 {
+		file = path.Join(os.Getenv("HOME"), ".hsm-signer-ledger")
+	}
+	entries := []*Entry{}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		log.Println("Ledger file did not exist.  Initializing: ", file)
+	} else {
+		yamlFile, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal("Unable to read ledger file: ", file)
+		}
+		if err = yaml.Unmarshal(yamlFile, &entries); err != nil {
+			log.Fatal("Unable to parse ledger file: ", file)
+		}
+	}
+
+	l := &FileLedger{
+		file:    file,
+		entries: entries,
+		mux:     sync.Mutex{},
+	}
+	// Verify we can write to disk before returning
+	if l.saveToDisk() != nil {
+		log.Fatal("Could not write to ledger file")
+	}
+	return l
+}
+
+// saveToDisk the ledger entries
+func (l *FileLedger) saveToDisk() error {
+	bytes, err := yaml.Marshal(l.entries)
+	if err != nil {
+		log.Println("Unable to marshall ledger entries")
+		return err
+	}
+	err = ioutil.WriteFile(l.file, bytes, 0644)
+	if err != nil {
+		log.Println("Unable to write ledger file: " + l.file)
+		return err
+	}
+	return nil
+}
+
+// Spent returns the total recorded for the account since the time
+func (l *FileLedger) Spent(account string, since time.Time) (*big.Int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return sum(l.entries, account, since), nil
+}
+
+// Reserve an amount spent by the account at the time unless the total would
+// reach max, and persist the ledger
+func (l *FileLedger) Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	entries, total, reserved := reserve(l.entries, account, at, amount, max)
+	if !reserved {
+		return total, false, nil
+	}
+	previous := l.entries
+	l.entries = entries
+	if err := l.saveToDisk(); err != nil {
+		l.entries = previous
+		return total, false, err
+	}
+	return total, true, nil
+}
+
+// Release an amount reserved by the account at the time and persist the
+// ledger
+func (l *FileLedger) Release(account string, at time.Time, amount *big.Int) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.entries = release(l.entries, account, at, amount)
+	return l.saveToDisk()
+}
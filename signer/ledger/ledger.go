@@ -0,0 +1,81 @@
+package ledger
+
+import (
+	"math/big"
+	"time"
+)
+
+// Window that daily limits are enforced over.  Entries older than this are
+// pruned.
+const Window = 24 * time.Hour
+
+// Ledger records the amounts spent by each account, e.g. the transfers
+// counted towards --tx-daily-max, so daily limits hold across restarts and
+// replicas sharing a backend
+type Ledger interface {
+	// Spent returns the total recorded for the account since the time
+	Spent(account string, since time.Time) (*big.Int, error)
+	// Reserve records an amount spent by the account at the time unless the
+	// total over the window would reach max, returning the total.  Checking
+	// and recording is atomic, even across replicas.
+	Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error)
+	// Release an amount reserved by the account at the time that wasn't spent
+	Release(account string, at time.Time, amount *big.Int) error
+}
+
+// Entry of a single spend
+type Entry struct {
+	Account string    `yaml:"Account"`
+	Time    time.Time `yaml:"Time"`
+	Amount  string    `yaml:"Amount"`
+}
+
+// sum the amounts of entries of the account since the time
+func sum(entries []*Entry, account string, since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, entry := range entries {
+		if entry.Account != account || entry.Time.Before(since) {
+			continue
+		}
+		if amount, ok := new(big.Int).SetString(entry.Amount, 10); ok {
+			total.Add(total, amount)
+		}
+	}
+	return total
+}
+
+// reserve the amount in the entries unless the total over the window would
+// reach max, returning the entries, the total and whether it was reserved
+func reserve(entries []*Entry, account string, at time.Time, amount *big.Int, max *big.Int) ([]*Entry, *big.Int, bool) {
+	total := sum(entries, account, at.Add(-Window))
+	total.Add(total, amount)
+	if total.Cmp(max) != -1 {
+		return entries, total, false
+	}
+	return append(prune(entries, at), &Entry{
+		Account: account,
+		Time:    at,
+		Amount:  amount.String(),
+	}), total, true
+}
+
+// release the entry of the amount reserved by the account at the time
+func release(entries []*Entry, account string, at time.Time, amount *big.Int) []*Entry {
+	for i, entry := range entries {
+		if entry.Account == account && entry.Time.Equal(at) && entry.Amount == amount.String() {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// prune entries older than the window
+func prune(entries []*Entry, now time.Time) []*Entry {
+	kept := []*Entry{}
+	for _, entry := range entries {
+		if now.Sub(entry.Time) <= Window {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
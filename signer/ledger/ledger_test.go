@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"fmt"
+	"math/big"
+	"path"
+	"testing"
+	"time"
+)
+
+func assert(t *testing.T, condition bool, errorMessage string) {
+	if !condition {
+		fmt.Println("Test Failure: ", errorMessage)
+		t.Fail()
+	}
+}
+
+// testRecord reserves the amount without a limit
+func testRecord(l Ledger, account string, at time.Time, amount int64) bool {
+	_, reserved, err := l.Reserve(account, at, big.NewInt(amount), big.NewInt(1<<62))
+	return err == nil && reserved
+}
+
+func testRollingWindow(t *testing.T, name string, l Ledger) {
+	now := time.Now()
+	since := now.Add(-Window)
+
+	assert(t, testRecord(l, "tx", now.Add(-25*time.Hour), 100), name+": Record should succeed")
+	assert(t, testRecord(l, "tx", now.Add(-23*time.Hour), 10), name+": Record should succeed")
+	assert(t, testRecord(l, "tx", now, 1), name+": Record should succeed")
+	assert(t, testRecord(l, "other", now, 1000), name+": Record should succeed")
+
+	spent, err := l.Spent("tx", since)
+	assert(t, err == nil && spent.Cmp(big.NewInt(11)) == 0, fmt.Sprintf("%v: Expected 11 spent in the window, got %v", name, spent))
+	// An hour later the spend from 23 hours ago leaves the window
+	spent, err = l.Spent("tx", since.Add(time.Hour+time.Minute))
+	assert(t, err == nil && spent.Cmp(big.NewInt(1)) == 0, fmt.Sprintf("%v: Expected 1 spent an hour later, got %v", name, spent))
+}
+
+func testReserve(t *testing.T, name string, l Ledger) {
+	now := time.Now()
+	max := big.NewInt(10)
+
+	total, reserved, err := l.Reserve("limited", now, big.NewInt(6), max)
+	assert(t, err == nil && reserved && total.Cmp(big.NewInt(6)) == 0, fmt.Sprintf("%v: Expected 6 to be reserved, got %v", name, total))
+	total, reserved, err = l.Reserve("limited", now.Add(time.Second), big.NewInt(4), max)
+	assert(t, err == nil && !reserved && total.Cmp(max) == 0, fmt.Sprintf("%v: Expected reaching the max to be refused, got %v", name, total))
+	spent, _ := l.Spent("limited", now.Add(-Window))
+	assert(t, spent.Cmp(big.NewInt(6)) == 0, fmt.Sprintf("%v: Expected a refused reservation not to be recorded, got %v", name, spent))
+
+	// Released amounts no longer count
+	assert(t, l.Release("limited", now, big.NewInt(6)) == nil, name+": Release should succeed")
+	_, reserved, err = l.Reserve("limited", now.Add(time.Second), big.NewInt(4), max)
+	assert(t, err == nil && reserved, name+": Expected a reservation once released")
+}
+
+func TestSessionLedger(t *testing.T) {
+	testRollingWindow(t, "Session", GetSessionLedger())
+	testReserve(t, "Session", GetSessionLedger())
+}
+
+func TestFileLedger(t *testing.T) {
+	file := path.Join(t.TempDir(), "ledger")
+	testRollingWindow(t, "File", GetFileLedger(file))
+	testReserve(t, "File", GetFileLedger(file))
+
+	// Spends survive a restart
+	spent, err := GetFileLedger(file).Spent("other", time.Now().Add(-Window))
+	assert(t, err == nil && spent.Cmp(big.NewInt(1000)) == 0, fmt.Sprintf("File: Expected 1000 spent after reloading, got %v", spent))
+}
@@ -0,0 +1,50 @@
+package ledger
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+// SessionLedger records spends in memory
+type SessionLedger struct {
+	entries []*Entry
+	mux     sync.Mutex
+}
+
+// GetSessionLedger returns a new in-memory ledger
+func GetSessionLedger() *SessionLedger {
+	return &SessionLedger{
+		entries: []*Entry{},
+		mux:     sync.Mutex{},
+	}
+}
+
+// Spent returns the total recorded for the account since the time
+func (l *SessionLedger) Spent(account string, since time.Time) (*big.Int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return sum(l.entries, account, since), nil
+}
+
+// Reserve an amount spent by the account at the time unless the total would
+// reach max
+func (l *SessionLedger) Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var total *big.Int
+	var reserved bool
+	l.entries, total, reserved = reserve(l.entries, account, at, amount, max)
+	return total, reserved, nil
+}
+
+// Release an amount reserved by the account at the time
+func (l *SessionLedger) Release(account string, at time.Time, amount *big.Int) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.entries = release(l.entries, account, at, amount)
+	return nil
+}
@@ -0,0 +1,114 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+)
+
+// SQLLedger records spends in a SQL table shared by replicas.  Queries use
+// PostgreSQL placeholders.
+type SQLLedger struct {
+	table string
+	db    *sql.DB
+}
+
+// GetSQLLedger returns a new SQL ledger, creating its table if needed
+func GetSQLLedger(driver string, dsn string, table string) *SQLLedger {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		log.Fatal("Unable to initialize SQL ledger: ", err)
+	}
+	l := &SQLLedger{
+		table: quoteIdentifier(table),
+		db:    db,
+	}
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+		account TEXT NOT NULL,
+		spent_at BIGINT NOT NULL,
+		amount TEXT NOT NULL
+	)`, l.table))
+	if err != nil {
+		log.Fatal("Unable to create SQL ledger table: ", err)
+	}
+	return l
+}
+
+// quoteIdentifier so table names may contain dashes
+func quoteIdentifier(identifier string) string {
+	return `"` + identifier + `"`
+}
+
+// Spent returns the total recorded for the account since the time
+func (l *SQLLedger) Spent(account string, since time.Time) (*big.Int, error) {
+	rows, err := l.db.Query(fmt.Sprintf("SELECT amount FROM %v WHERE account = $1 AND spent_at >= $2", l.table), account, since.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	return sumRows(rows)
+}
+
+// sumRows of amounts, closing them
+func sumRows(rows *sql.Rows) (*big.Int, error) {
+	defer rows.Close()
+
+	total := new(big.Int)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		amount, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid ledger amount: %v", value)
+		}
+		total.Add(total, amount)
+	}
+	return total, rows.Err()
+}
+
+// Reserve an amount spent by the account at the time unless the total would
+// reach max, pruning entries older than the window.  A transaction scoped
+// lock on the account makes replicas reserve one at a time.
+func (l *SQLLedger) Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error) {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", l.table+":"+account); err != nil {
+		return nil, false, err
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT amount FROM %v WHERE account = $1 AND spent_at >= $2", l.table), account, at.Add(-Window).UnixNano())
+	if err != nil {
+		return nil, false, err
+	}
+	total, err := sumRows(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	total.Add(total, amount)
+	if total.Cmp(max) != -1 {
+		return total, false, nil
+	}
+	if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %v (account, spent_at, amount) VALUES ($1, $2, $3)", l.table), account, at.UnixNano(), amount.String()); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	if _, err := l.db.Exec(fmt.Sprintf("DELETE FROM %v WHERE spent_at < $1", l.table), at.Add(-Window).UnixNano()); err != nil {
+		log.Println("Warning: Unable to prune the SQL ledger:", err)
+	}
+	return total, true, nil
+}
+
+// Release an amount reserved by the account at the time
+func (l *SQLLedger) Release(account string, at time.Time, amount *big.Int) error {
+	_, err := l.db.Exec(fmt.Sprintf("DELETE FROM %v WHERE account = $1 AND spent_at = $2 AND amount = $3", l.table), account, at.UnixNano(), amount.String())
+	return err
+}
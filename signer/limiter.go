@@ -0,0 +1,110 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/siler23/tezos-hsm-signer/signer/ledger"
+)
+
+// Limiter of daily limits.  Spends of an allowed operation are reserved in
+// the ledger while it's signed, so concurrent requests, even to other
+// replicas, can't exceed a limit, then kept once it's signed or released.
+// The ledger reserves atomically, so requests aren't serialized here.
+type Limiter struct {
+	ledger ledger.Ledger
+}
+
+// Reservation of the spends of an operation being signed
+type Reservation struct {
+	limiter *Limiter
+	spends  []*reservedSpend
+	done    bool
+	mux     sync.Mutex
+}
+
+// reservedSpend in the ledger at a time
+type reservedSpend struct {
+	*Spend
+	at time.Time
+}
+
+// limiterInit guards creating the limiter of filters that weren't given one
+var limiterInit sync.Mutex
+
+// NewLimiter of spends recorded in the ledger
+func NewLimiter(l ledger.Ledger) *Limiter {
+	return &Limiter{
+		ledger: l,
+	}
+}
+
+// limits of this filter, in memory unless a limiter was set
+func (filter *OperationFilter) limits() *Limiter {
+	limiterInit.Lock()
+	defer limiterInit.Unlock()
+
+	if filter.Limiter == nil {
+		filter.Limiter = NewLimiter(ledger.GetSessionLedger())
+	}
+	return filter.Limiter
+}
+
+// spent by the account over the window, including reservations
+func (limiter *Limiter) spent(account string) (*big.Int, error) {
+	return limiter.ledger.Spent(account, time.Now().Add(-ledger.Window))
+}
+
+// reserve the spends of the allowed decisions in the ledger.  If one would
+// exceed its limit, those already reserved are released and the decision
+// that blocks it is returned instead.
+func (limiter *Limiter) reserve(decisions []*FilterDecision) (*Reservation, *FilterDecision) {
+	reservation := &Reservation{limiter: limiter}
+	for _, decision := range decisions {
+		spend := &reservedSpend{Spend: decision.spend, at: time.Now()}
+		total, reserved, err := limiter.ledger.Reserve(spend.Account, spend.at, spend.Amount, spend.Max)
+		if err != nil || !reserved {
+			limiter.release(reservation.spends)
+			if err != nil {
+				return nil, denyWith(ReasonBackendError, decision.Rule, decision.Subject, "unable to reserve in the ledger: "+err.Error())
+			}
+			reason := fmt.Sprintf("%v of the daily max of %v spent", total, spend.Max)
+			return nil, denyWith(ReasonLimitExceeded, decision.Rule, decision.Subject, reason)
+		}
+		reservation.spends = append(reservation.spends, spend)
+	}
+	return reservation, nil
+}
+
+// release reserved spends from the ledger
+func (limiter *Limiter) release(spends []*reservedSpend) {
+	for _, spend := range spends {
+		if err := limiter.ledger.Release(spend.Account, spend.at, spend.Amount); err != nil {
+			log.Printf("[ERROR] Unable to release %v reserved by %v: %v\n", spend.Amount, spend.Account, err)
+		}
+	}
+}
+
+// Commit the spends of a signed operation, keeping them in the ledger
+func (reservation *Reservation) Commit() {
+	reservation.mux.Lock()
+	defer reservation.mux.Unlock()
+
+	reservation.done = true
+}
+
+// Release the spends of an operation that wasn't signed.  Does nothing once
+// committed.
+func (reservation *Reservation) Release() {
+	reservation.mux.Lock()
+	defer reservation.mux.Unlock()
+
+	if reservation.done {
+		return
+	}
+	reservation.done = true
+	reservation.limiter.release(reservation.spends)
+}
@@ -0,0 +1,163 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siler23/tezos-hsm-signer/signer/ledger"
+	"github.com/siler23/tezos-hsm-signer/signer/watermark"
+)
+
+func TestLimiterReservations(t *testing.T) {
+	// Room for exactly two transfers of 1001283 uXTZ
+	filter := &OperationFilter{EnableTx: true, TxDailyMax: big.NewInt(3000000)}
+	op, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+
+	first, blocked := filter.Authorize(op, nil)
+	if blocked != nil {
+		log.Println("[Limiter Test] First transfer should be allowed")
+		t.Fail()
+		return
+	}
+	second, blocked := filter.Authorize(op, nil)
+	if blocked != nil {
+		log.Println("[Limiter Test] Second transfer should be allowed")
+		t.Fail()
+		return
+	}
+	// Reserved spends count until released
+	if _, blocked = filter.Authorize(op, nil); blocked == nil || blocked.Code != ReasonLimitExceeded {
+		log.Println("[Limiter Test] Third transfer should be blocked by reservations")
+		t.Fail()
+	}
+	second.Release()
+	first.Commit()
+	// Releasing a committed reservation does nothing
+	first.Release()
+	third, blocked := filter.Authorize(op, nil)
+	if blocked != nil {
+		log.Println("[Limiter Test] Third transfer should be allowed once released")
+		t.Fail()
+		return
+	}
+	third.Commit()
+	if _, blocked = filter.Authorize(op, nil); blocked == nil || blocked.Code != ReasonLimitExceeded {
+		log.Println("[Limiter Test] Fourth transfer should be over the daily max")
+		t.Fail()
+	}
+}
+
+func TestSharedLedgerReservations(t *testing.T) {
+	// Replicas sharing a ledger have room for exactly two transfers between them
+	shared := ledger.GetSessionLedger()
+	replicas := []*OperationFilter{
+		&OperationFilter{EnableTx: true, TxDailyMax: big.NewInt(3000000), Limiter: NewLimiter(shared)},
+		&OperationFilter{EnableTx: true, TxDailyMax: big.NewInt(3000000), Limiter: NewLimiter(shared)},
+	}
+	op, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+
+	first, blocked := replicas[0].Authorize(op, nil)
+	if blocked != nil {
+		log.Println("[Limiter Test] First replica should reserve a transfer")
+		t.FailNow()
+	}
+	if _, blocked := replicas[1].Authorize(op, nil); blocked != nil {
+		log.Println("[Limiter Test] Second replica should reserve a transfer")
+		t.FailNow()
+	}
+	if _, blocked := replicas[1].Authorize(op, nil); blocked == nil || blocked.Code != ReasonLimitExceeded || blocked.Rule != "tx-daily-max" {
+		log.Printf("[Limiter Test] Reservations of the other replica should count.  Received %+v\n", blocked)
+		t.Fail()
+	}
+	first.Release()
+	if _, blocked := replicas[1].Authorize(op, nil); blocked != nil {
+		log.Println("[Limiter Test] A transfer should be allowed once the other replica releases")
+		t.Fail()
+	}
+}
+
+// blockingLedger holds reservations until it's unblocked
+type blockingLedger struct {
+	*ledger.SessionLedger
+	unblock chan bool
+}
+
+func (l *blockingLedger) Reserve(account string, at time.Time, amount *big.Int, max *big.Int) (*big.Int, bool, error) {
+	<-l.unblock
+	return l.SessionLedger.Reserve(account, at, amount, max)
+}
+
+func TestSlowLedgerDoesNotBlockConsensus(t *testing.T) {
+	slow := &blockingLedger{SessionLedger: ledger.GetSessionLedger(), unblock: make(chan bool)}
+	filter := &OperationFilter{EnableTx: true, TxDailyMax: big.NewInt(3000000), Limiter: NewLimiter(slow)}
+	transfer, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+	endorsement, _ := ParseOperation([]byte(testEndorse.Operation))
+
+	reserved := make(chan *FilterDecision)
+	go func() {
+		_, blocked := filter.Authorize(transfer, nil)
+		reserved <- blocked
+	}()
+	authorized := make(chan *FilterDecision)
+	go func() {
+		_, blocked := filter.Authorize(endorsement, nil)
+		authorized <- blocked
+	}()
+	select {
+	case blocked := <-authorized:
+		if blocked != nil {
+			log.Printf("[Limiter Test] Expected the endorsement to be allowed.  Received %+v\n", blocked)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		log.Println("[Limiter Test] The endorsement waited for the transfer's ledger reservation")
+		t.Fail()
+	}
+	close(slow.unblock)
+	if blocked := <-reserved; blocked != nil {
+		log.Printf("[Limiter Test] Expected the transfer to be reserved.  Received %+v\n", blocked)
+		t.Fail()
+	}
+}
+
+func TestConcurrentPostTxLimit(t *testing.T) {
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	server.signer = &testSigner{SignedBytes: signedBytes}
+	// Sign the same counter repeatedly so only the daily max limits transfers
+	server.watermark = watermark.GetIgnoreWatermark()
+	server.filter.EnableTx = true
+	// Room for exactly five transfers of 1001283 uXTZ
+	server.filter.TxDailyMax = big.NewInt(5500000)
+
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	signed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/keys/"+testSecp256k1Tx.PublicKeyHash, bytes.NewReader([]byte(testSecp256k1Tx.Operation)))
+			w := httptest.NewRecorder()
+			Middleware(server.RouteKeys)(w, r)
+			if w.Result().StatusCode == http.StatusOK {
+				mux.Lock()
+				signed++
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if signed != 5 {
+		log.Printf("[Concurrent Limit Test] Expected 5 transfers to be signed.  Signed %v\n", signed)
+		t.Fail()
+	}
+}
@@ -0,0 +1,207 @@
+package signer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// MichelineKind of a Micheline node
+type MichelineKind int
+
+// Kinds of Micheline nodes
+const (
+	michelineInt MichelineKind = iota + 1
+	michelineString
+	michelineBytes
+	michelineSeq
+	michelinePrim
+)
+
+// Micheline is a decoded Micheline expression, the representation of
+// Michelson code, types and values.  Only the fields of its Kind are set.
+type Micheline struct {
+	Kind   MichelineKind
+	Int    *big.Int
+	String string
+	Bytes  []byte
+	Prim   string
+	// Args of a primitive, or the elements of a sequence
+	Args   []*Micheline
+	Annots []string
+}
+
+// Michelson primitives in the order of their binary tags
+// Defined in: https://gitlab.com/tezos/tezos/blob/master/src/proto_alpha/lib_protocol/michelson_v1_primitives.ml
+var michelsonPrimitives = []string{
+	"parameter", "storage", "code", "False", "Elt", "Left", "None", "Pair",
+	"Right", "Some", "True", "Unit", "PACK", "UNPACK", "BLAKE2B", "SHA256",
+	"SHA512", "ABS", "ADD", "AMOUNT", "AND", "BALANCE", "CAR", "CDR",
+	"CHECK_SIGNATURE", "COMPARE", "CONCAT", "CONS", "CREATE_ACCOUNT", "CREATE_CONTRACT", "IMPLICIT_ACCOUNT", "DIP",
+	"DROP", "DUP", "EDIV", "EMPTY_MAP", "EMPTY_SET", "EQ", "EXEC", "FAILWITH",
+	"GE", "GET", "GT", "HASH_KEY", "IF", "IF_CONS", "IF_LEFT", "IF_NONE",
+	"INT", "LAMBDA", "LE", "LEFT", "LOOP", "LSL", "LSR", "LT",
+	"MAP", "MEM", "MUL", "NEG", "NEQ", "NIL", "NONE", "NOT",
+	"NOW", "OR", "PAIR", "PUSH", "RIGHT", "SIZE", "SOME", "SOURCE",
+	"SENDER", "SELF", "STEPS_TO_QUOTA", "SUB", "SWAP", "TRANSFER_TOKENS", "SET_DELEGATE", "UNIT",
+	"UPDATE", "XOR", "ITER", "LOOP_LEFT", "ADDRESS", "CONTRACT", "ISNAT", "CAST",
+	"RENAME", "bool", "contract", "int", "key", "key_hash", "lambda", "list",
+	"map", "big_map", "nat", "option", "or", "pair", "set", "signature",
+	"string", "bytes", "mutez", "timestamp", "unit", "operation", "address", "SLICE",
+	"DIG", "DUG", "EMPTY_BIG_MAP", "APPLY", "chain_id", "CHAIN_ID", "LEVEL", "SELF_ADDRESS",
+	"never", "NEVER", "UNPAIR", "VOTING_POWER", "TOTAL_VOTING_POWER", "KECCAK", "SHA3", "PAIRING_CHECK",
+	"bls12_381_g1", "bls12_381_g2", "bls12_381_fr", "sapling_state", "sapling_transaction_deprecated", "SAPLING_EMPTY_STATE", "SAPLING_VERIFY_UPDATE", "ticket",
+	"TICKET_DEPRECATED", "READ_TICKET", "SPLIT_TICKET", "JOIN_TICKETS", "GET_AND_UPDATE", "chest", "chest_key", "OPEN_CHEST",
+	"VIEW", "view", "constant", "SUB_MUTEZ", "tx_rollup_l2_address", "MIN_BLOCK_TIME", "sapling_transaction", "EMIT",
+	"Lambda_rec", "LAMBDA_REC", "TICKET", "BYTES", "NAT",
+}
+
+// Deepest expression we'll decode, guarding the stack against hostile input
+const michelineMaxDepth = 1000
+
+// decodeMichelineBytes decodes bytes that hold exactly one expression
+func decodeMichelineBytes(bytes []byte) (*Micheline, error) {
+	d := newDecoder(bytes)
+	expr, err := decodeMicheline(d, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.remaining() != 0 {
+		return nil, fmt.Errorf("%v unexpected bytes after micheline expression", d.remaining())
+	}
+	return expr, nil
+}
+
+// decodeMicheline reads a single binary encoded expression
+// Follows: https://gitlab.com/tezos/tezos/blob/master/src/lib_micheline/micheline_encoding.ml
+func decodeMicheline(d *decoder, depth int) (*Micheline, error) {
+	if depth > michelineMaxDepth {
+		return nil, fmt.Errorf("micheline expression is nested deeper than %v", michelineMaxDepth)
+	}
+	tag, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case 0x00:
+		num, err := d.readInt()
+		return &Micheline{Kind: michelineInt, Int: num}, err
+	case 0x01:
+		str, err := d.readVariableBytes()
+		return &Micheline{Kind: michelineString, String: string(str)}, err
+	case 0x02:
+		seq, err := d.readVariableBytes()
+		if err != nil {
+			return nil, err
+		}
+		args, err := decodeMichelineSeq(seq, depth)
+		return &Micheline{Kind: michelineSeq, Args: args}, err
+	case 0x03, 0x04, 0x05, 0x06, 0x07, 0x08:
+		// Primitives with 0, 1 or 2 args, each with or without annotations
+		expr, err := decodeMichelinePrim(d)
+		if err != nil {
+			return nil, err
+		}
+		argCount := int(tag-0x03) / 2
+		for i := 0; i < argCount; i++ {
+			arg, err := decodeMicheline(d, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			expr.Args = append(expr.Args, arg)
+		}
+		if (tag-0x03)%2 == 1 {
+			expr.Annots, err = decodeMichelineAnnots(d)
+		}
+		return expr, err
+	case 0x09:
+		// Primitives with any number of args and annotations
+		expr, err := decodeMichelinePrim(d)
+		if err != nil {
+			return nil, err
+		}
+		seq, err := d.readVariableBytes()
+		if err != nil {
+			return nil, err
+		}
+		if expr.Args, err = decodeMichelineSeq(seq, depth); err != nil {
+			return nil, err
+		}
+		expr.Annots, err = decodeMichelineAnnots(d)
+		return expr, err
+	case 0x0a:
+		bytes, err := d.readVariableBytes()
+		return &Micheline{Kind: michelineBytes, Bytes: bytes}, err
+	default:
+		return nil, fmt.Errorf("unknown micheline tag 0x%02x at offset %v", tag, d.offset-1)
+	}
+}
+
+// decodeMichelineSeq decodes every expression in the bytes of a sequence
+func decodeMichelineSeq(bytes []byte, depth int) ([]*Micheline, error) {
+	d := newDecoder(bytes)
+	exprs := []*Micheline{}
+	for d.remaining() > 0 {
+		expr, err := decodeMicheline(d, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// decodeMichelinePrim reads the primitive's tag
+func decodeMichelinePrim(d *decoder) (*Micheline, error) {
+	prim, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+	if int(prim) >= len(michelsonPrimitives) {
+		return nil, fmt.Errorf("unknown michelson primitive 0x%02x at offset %v", prim, d.offset-1)
+	}
+	return &Micheline{Kind: michelinePrim, Prim: michelsonPrimitives[prim]}, nil
+}
+
+// decodeMichelineAnnots reads space separated annotations
+func decodeMichelineAnnots(d *decoder) ([]string, error) {
+	annots, err := d.readVariableBytes()
+	if err != nil || len(annots) == 0 {
+		return nil, err
+	}
+	return strings.Split(string(annots), " "), nil
+}
+
+// IsPrim is true if this node is the named primitive with argCount args
+func (expr *Micheline) IsPrim(prim string, argCount int) bool {
+	return expr != nil && expr.Kind == michelinePrim && expr.Prim == prim && len(expr.Args) == argCount
+}
+
+// MarshalJSON in the JSON representation of Micheline used by Tezos RPCs
+func (expr *Micheline) MarshalJSON() ([]byte, error) {
+	switch expr.Kind {
+	case michelineInt:
+		return json.Marshal(map[string]string{"int": expr.Int.String()})
+	case michelineString:
+		return json.Marshal(map[string]string{"string": expr.String})
+	case michelineBytes:
+		return json.Marshal(map[string]string{"bytes": hex.EncodeToString(expr.Bytes)})
+	case michelineSeq:
+		if expr.Args == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(expr.Args)
+	default:
+		prim := map[string]interface{}{"prim": expr.Prim}
+		if len(expr.Args) > 0 {
+			prim["args"] = expr.Args
+		}
+		if len(expr.Annots) > 0 {
+			prim["annots"] = expr.Annots
+		}
+		return json.Marshal(prim)
+	}
+}
@@ -0,0 +1,98 @@
+package signer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"testing"
+)
+
+// Helpers to forge binary Micheline in tests
+func testMichelineString(str string) string {
+	return fmt.Sprintf("01%08x%v", len(str), hex.EncodeToString([]byte(str)))
+}
+
+func testMichelineBytes(bytes string) string {
+	return fmt.Sprintf("0a%08x%v", len(bytes)/2, bytes)
+}
+
+func testMichelinePair(left string, right string) string {
+	return "0707" + left + right
+}
+
+func testMichelineSeq(exprs ...string) string {
+	seq := ""
+	for _, expr := range exprs {
+		seq += expr
+	}
+	return fmt.Sprintf("02%08x%v", len(seq)/2, seq)
+}
+
+// testContractCall forges a call from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m to
+// KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp with the provided counter and parameters
+func testContractCall(counter uint8, entrypoint string, value string) string {
+	return fmt.Sprintf("\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f"+
+		"6c0154f5d8f71ce18f9f05bb885a4120e64c667bc1b401%02x030400016e7c23cc06c7b0743256f65e34d5b0f7c91e4eb200"+
+		"ffff%02x%v%08x%v\"", counter, len(entrypoint), hex.EncodeToString([]byte(entrypoint)), len(value)/2, value)
+}
+
+func TestDecodeMicheline(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Binary string
+		JSON   string
+	}{
+		{"Int", "00a401", `{"int":"100"}`},
+		{"Negative Int", "0041", `{"int":"-1"}`},
+		{"String", testMichelineString("hello"), `{"string":"hello"}`},
+		{"Bytes", testMichelineBytes("cafe"), `{"bytes":"cafe"}`},
+		{"Empty Seq", "0200000000", `[]`},
+		{"Pair", testMichelinePair("0001", testMichelineString("a")), `{"args":[{"int":"1"},{"string":"a"}],"prim":"Pair"}`},
+		{"Annotated Prim", "046200000004256e6174", `{"annots":["%nat"],"prim":"nat"}`},
+		{"Generic Prim", "09070000000600010002000300000000", `{"args":[{"int":"1"},{"int":"2"},{"int":"3"}],"prim":"Pair"}`},
+	}
+	for _, test := range tests {
+		bytes, _ := hex.DecodeString(test.Binary)
+		expr, err := decodeMichelineBytes(bytes)
+		if err != nil {
+			log.Printf("[Micheline Test - %v] Unable to decode: %v\n", test.Name, err)
+			t.Fail()
+			continue
+		}
+		encoded, _ := json.Marshal(expr)
+		if string(encoded) != test.JSON {
+			log.Printf("[Micheline Test - %v] Expected %v, received %v\n", test.Name, test.JSON, string(encoded))
+			t.Fail()
+		}
+	}
+
+	for _, invalid := range []string{"", "00", "01000000ff", "03ff", "0707", "000100"} {
+		bytes, _ := hex.DecodeString(invalid)
+		if _, err := decodeMichelineBytes(bytes); err == nil {
+			log.Printf("[Micheline Test] %v should fail to decode\n", invalid)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseContractCall(t *testing.T) {
+	value := testMichelinePair(testMichelineString("tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m"),
+		testMichelinePair(testMichelineString("tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"), "00a401"))
+	op, _ := ParseOperation([]byte(testContractCall(2, "transfer", value)))
+	generic := GetGenericOperation(op)
+
+	params := generic.TransactionParameters()
+	if params == nil || params.Entrypoint != "transfer" {
+		log.Printf("[Contract Call Test] Expected a call to the transfer entrypoint, received %+v\n", params)
+		t.FailNow()
+	}
+	if !params.Value.IsPrim("Pair", 2) || params.Value.Args[1].Args[1].Int.Int64() != 100 {
+		log.Println("[Contract Call Test] Incorrectly decoded parameter value")
+		t.Fail()
+	}
+	if generic.TransactionDestination() != PubkeyHashToByteString("KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp") {
+		log.Println("[Contract Call Test] Contract calls should have a destination")
+		t.Fail()
+	}
+}
@@ -21,23 +21,64 @@ const (
 	opMagicByteBlock       = 0x01
 	opMagicByteEndorsement = 0x02
 	opMagicByteGeneric     = 0x03
+	opMagicBytePackedData  = 0x05
+
+	opMagicByteTenderbakeBlock          = 0x11
+	opMagicByteTenderbakePreendorsement = 0x12
+	opMagicByteTenderbakeEndorsement    = 0x13
+)
+
+// Reasons an operation can fail to parse, matched with errors.Is
+var (
+	ErrOperationQuotes      = errors.New("A valid operation begins and ends with a quote")
+	ErrOperationHex         = errors.New("Operation is not valid hex")
+	ErrUnsupportedMagicByte = errors.New("Unsupported operation magic byte")
+	ErrMalformedOperation   = errors.New("Malformed operation")
 )
 
+// ParseError explains why an operation could not be parsed
+type ParseError struct {
+	// Reason is one of the ErrOperation* errors
+	Reason error
+	// Err is the underlying cause, if any
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Err == nil {
+		return "Operation: " + e.Reason.Error()
+	}
+	return fmt.Sprintf("Operation: %v: %v", e.Reason, e.Err)
+}
+
+// Is this error caused by the target reason?
+func (e *ParseError) Is(target error) bool {
+	return target == e.Reason
+}
+
+// Unwrap the underlying cause
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // ParseOperation parses a raw byte string into a meaningful tz operation
-// and performs simple validation
+// and validates that every field we read from it is present
 func ParseOperation(opBytes []byte) (*Operation, error) {
 
 	// Must begin and end with quotes
 	opString := strings.TrimSpace(string(opBytes))
-	if !strings.HasPrefix(opString, "\"") || !strings.HasSuffix(opString, "\"") {
-		return nil, errors.New("A valid operation begins and ends with a quote")
+	if len(opString) < 2 || !strings.HasPrefix(opString, "\"") || !strings.HasSuffix(opString, "\"") {
+		return nil, &ParseError{Reason: ErrOperationQuotes}
 	}
 	opString = strings.Trim(opString, "\"")
 
 	// Must be valid hex chars
 	parsedHex, err := hex.DecodeString(opString)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Reason: ErrOperationHex, Err: err}
+	}
+	if len(parsedHex) == 0 {
+		return nil, &ParseError{Reason: ErrMalformedOperation, Err: errors.New("empty operation")}
 	}
 
 	op := Operation{
@@ -45,20 +86,51 @@ func ParseOperation(opBytes []byte) (*Operation, error) {
 	}
 
 	// Validate and print debug statements
+	switch op.MagicByte() {
+	case opMagicByteGeneric:
+		err = validateGeneric(newDecoder(op.hex[1:]))
+	case opMagicByteBlock, opMagicByteTenderbakeBlock:
+		err = new(BlockHeader).decodeShell(newDecoder(op.hex[1:]))
+	case opMagicByteEndorsement, opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		_, err = decodeConsensusOperation(op.MagicByte(), op.hex[1:])
+	case opMagicBytePackedData:
+		_, err = decodeMichelineBytes(op.hex[1:])
+	default:
+		return nil, &ParseError{Reason: ErrUnsupportedMagicByte, Err: fmt.Errorf("0x%02x", op.MagicByte())}
+	}
+	if err != nil {
+		return nil, &ParseError{Reason: ErrMalformedOperation, Err: err}
+	}
+
 	switch op.MagicByte() {
 	case opMagicByteGeneric:
 		debugln("Operation is Generic.  Possibly a Transaction")
-	case opMagicByteBlock:
+	case opMagicBytePackedData:
+		debugln("Operation is Packed Data")
+	case opMagicByteBlock, opMagicByteTenderbakeBlock:
 		debugln("Operation is a Block at level: ", op.Level().String())
-	case opMagicByteEndorsement:
-		debugln("Operation is an Endorsement at level: ", op.Level().String())
-	default:
-		return nil, fmt.Errorf("Operation: Unsupported Operation MagicByte: %v", op.MagicByte())
+	case opMagicByteEndorsement, opMagicByteTenderbakeEndorsement:
+		debugln("Operation is an Endorsement at level: ", op.Level().String(), " round: ", op.Round())
+	case opMagicByteTenderbakePreendorsement:
+		debugln("Operation is a Preendorsement at level: ", op.Level().String(), " round: ", op.Round())
 	}
 
 	return &op, nil
 }
 
+// validateGeneric checks the branch and at least one content tag are
+// present.  Contents are decoded by the filter, as signing every generic
+// operation must keep working for kinds unknown to this version.
+func validateGeneric(d *decoder) error {
+	if _, err := d.readBytes(32); err != nil {
+		return err
+	}
+	if d.remaining() == 0 {
+		return errors.New("operation has no contents")
+	}
+	return nil
+}
+
 // Hex returns a copy of the parsed hex bytes of the operation
 func (op *Operation) Hex() []byte {
 	hexCopy := make([]byte, len(op.hex))
@@ -68,12 +140,21 @@ func (op *Operation) Hex() []byte {
 
 // MagicByte of this tezos operation included in the operation
 func (op *Operation) MagicByte() uint8 {
+	if len(op.hex) == 0 {
+		return 0
+	}
 	return op.hex[0]
 }
 
 // ChainID to determine what we're running on
 func (op *Operation) ChainID() string {
-	if op.MagicByte() == opMagicByteBlock || op.MagicByte() == opMagicByteEndorsement {
+	if len(op.hex) < 5 {
+		log.Println("Warn: Requested ChainID of a truncated operation")
+		return ""
+	}
+	switch op.MagicByte() {
+	case opMagicByteBlock, opMagicByteTenderbakeBlock, opMagicByteEndorsement,
+		opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
 		chainID := op.hex[1:5]
 		prefix, _ := hex.DecodeString(tzChainID)
 		return b58CheckEncode(prefix, chainID)
@@ -84,11 +165,51 @@ func (op *Operation) ChainID() string {
 
 // Level returns a copy of the level, if one can be parsed from this operation
 func (op *Operation) Level() *big.Int {
-	if op.MagicByte() == opMagicByteBlock {
-		return new(big.Int).SetBytes(op.hex[5:9])
-	} else if op.MagicByte() == opMagicByteEndorsement {
-		return new(big.Int).SetBytes(op.hex[len(op.hex)-4:])
+	switch op.MagicByte() {
+	case opMagicByteBlock, opMagicByteTenderbakeBlock:
+		header := GetBlockHeader(op)
+		if header.err != nil {
+			return nil
+		}
+		return big.NewInt(int64(header.Level))
+	case opMagicByteEndorsement, opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		consensus := GetConsensusOperation(op)
+		if consensus.err != nil {
+			return nil
+		}
+		return big.NewInt(int64(consensus.Level))
 	}
 	log.Println("Warn: Requested level for unexpected magic byte", op.MagicByte())
 	return nil
 }
+
+// Round of Tenderbake blocks and consensus operations.  Zero for Emmy.
+func (op *Operation) Round() int32 {
+	switch op.MagicByte() {
+	case opMagicByteTenderbakeBlock:
+		round, err := GetBlockHeader(op).Round()
+		if err != nil {
+			log.Println("Warn: Unable to read the round of the block:", err)
+		}
+		return round
+	case opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		return GetConsensusOperation(op).Round
+	}
+	return 0
+}
+
+// Watermark that must increase between operations signed with this magic
+// byte.  Tenderbake operations may be signed again at a higher round of the
+// same level, so their watermark is the level shifted above the round.
+func (op *Operation) Watermark() *big.Int {
+	level := op.Level()
+	if level == nil {
+		return nil
+	}
+	switch op.MagicByte() {
+	case opMagicByteTenderbakeBlock, opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+		watermark := new(big.Int).Lsh(level, 32)
+		return watermark.Or(watermark, big.NewInt(int64(op.Round())))
+	}
+	return level
+}
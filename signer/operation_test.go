@@ -1,6 +1,7 @@
 package signer
 
 import (
+	"errors"
 	"log"
 	"math/big"
 	"testing"
@@ -56,3 +57,60 @@ func TestParseEndorsement(t *testing.T) {
 func TestParseBlock(t *testing.T) {
 	testParse(t, testBlock, "Block")
 }
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		reason    error
+	}{
+		{"Empty", "", ErrOperationQuotes},
+		{"Single Quote", "\"", ErrOperationQuotes},
+		{"Empty Quotes", "\"\"", ErrMalformedOperation},
+		{"Odd Hex", "\"012\"", ErrOperationHex},
+		{"Unknown Magic Byte", "\"09\"", ErrUnsupportedMagicByte},
+		{"Bare Block", "\"01\"", ErrMalformedOperation},
+		{"Truncated Block", testBlock.Operation[:101] + "\"", ErrMalformedOperation},
+		{"Bare Endorsement", "\"02\"", ErrMalformedOperation},
+		{"Endorsement Without Level", testEndorse.Operation[:len(testEndorse.Operation)-9] + "\"", ErrMalformedOperation},
+		{"Bare Generic", "\"03\"", ErrMalformedOperation},
+		{"Generic Without Contents", testP256Tx.Operation[:67] + "\"", ErrMalformedOperation},
+	}
+	for _, test := range tests {
+		op, err := ParseOperation([]byte(test.operation))
+		if op != nil || !errors.Is(err, test.reason) {
+			log.Printf("[Malformed Test - %v] Expected %v, received %v\n", test.name, test.reason, err)
+			t.Fail()
+		}
+	}
+}
+
+func FuzzParseOperation(f *testing.F) {
+	for _, test := range []testOperation{testSecp256k1Tx, testP256Tx, testEndorse, testBlock} {
+		f.Add([]byte(test.Operation))
+	}
+	f.Add([]byte(testTenderbakeBlock()))
+	f.Add([]byte("\"05" + testPermit() + "\""))
+	f.Add([]byte(testTenderbakeConsensus(opMagicByteTenderbakeEndorsement, 0x15, 1, 259938, 0)))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		op, err := ParseOperation(body)
+		if err != nil {
+			return
+		}
+		switch op.MagicByte() {
+		case opMagicByteBlock, opMagicByteTenderbakeBlock, opMagicByteEndorsement,
+			opMagicByteTenderbakePreendorsement, opMagicByteTenderbakeEndorsement:
+			if op.Level() == nil || op.Watermark() == nil || op.ChainID() == "" {
+				t.Errorf("parsed operation without a level or chain ID: %x", op.Hex())
+			}
+		case opMagicByteGeneric:
+			GetGenericOperation(op).Contents()
+		case opMagicBytePackedData:
+			if _, err := GetPackedData(op); err != nil {
+				t.Errorf("parsed undecodable packed data: %x", op.Hex())
+			}
+		default:
+			t.Errorf("parsed operation with magic byte %v", op.MagicByte())
+		}
+	})
+}
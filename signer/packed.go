@@ -0,0 +1,217 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// PackedDataPolicy enables signing Michelson packed data (magic byte 0x05)
+// with a key, e.g. for TZIP-17 permits or "Tezos Signed Message" logins.
+// Data must be a string starting with one of StringPrefixes or match one of
+// the Michelson types in Shapes.  Without either, any data is signed.
+type PackedDataPolicy struct {
+	StringPrefixes []string `yaml:"StringPrefixes"`
+	Shapes         []string `yaml:"Shapes"`
+
+	shapes []*Micheline
+}
+
+// Arity of Michelson types taking arguments.  Pairs take two or more.
+var michelsonTypeArity = map[string]int{
+	"option": 1,
+	"list":   1,
+	"set":    1,
+	"or":     2,
+	"map":    2,
+}
+
+// Michelson types a value can be matched against
+var michelsonValueTypes = map[string]bool{
+	"unit": true, "bool": true, "int": true, "nat": true, "mutez": true,
+	"string": true, "bytes": true, "timestamp": true, "address": true,
+	"key_hash": true, "key": true, "signature": true, "chain_id": true,
+	"pair": true, "option": true, "or": true, "list": true, "set": true, "map": true,
+}
+
+// GetPackedData decodes the Micheline value of a packed data operation
+func GetPackedData(op *Operation) (*Micheline, error) {
+	if op.MagicByte() != opMagicBytePackedData {
+		return nil, fmt.Errorf("operation is not packed data")
+	}
+	return decodeMichelineBytes(op.hex[1:])
+}
+
+// evaluatePackedData against the policy of the key signing it
+func (key *Key) evaluatePackedData(op *Operation) *FilterDecision {
+	if key.PackedData == nil {
+		return deny("packed-data", key.Name, "packed data is disabled for this key")
+	}
+	data, err := GetPackedData(op)
+	if err != nil {
+		return denyWith(ReasonParseError, "decode", key.Name, "unable to decode packed data: "+err.Error())
+	}
+	decision := key.PackedData.evaluate(data)
+	decision.Subject = key.Name
+	return decision
+}
+
+// parseShapes of the policy, failing on any invalid Michelson type
+func (policy *PackedDataPolicy) parseShapes() {
+	policy.shapes = []*Micheline{}
+	for _, shape := range policy.Shapes {
+		ty, err := parseMichelsonType(shape)
+		if err != nil {
+			log.Fatalf("Invalid packed data shape %q: %v\n", shape, err)
+		}
+		policy.shapes = append(policy.shapes, ty)
+	}
+}
+
+// evaluate packed data against the policy
+func (policy *PackedDataPolicy) evaluate(data *Micheline) *FilterDecision {
+	if len(policy.StringPrefixes) == 0 && len(policy.Shapes) == 0 {
+		return allow("packed-data", "", "any packed data is allowed")
+	}
+	if data.Kind == michelineString {
+		for _, prefix := range policy.StringPrefixes {
+			if strings.HasPrefix(data.String, prefix) {
+				return allow("packed-data", "", fmt.Sprintf("string starts with %q", prefix))
+			}
+		}
+	}
+	for i, shape := range policy.shapes {
+		if matchesShape(data, shape) {
+			return allow("packed-data", "", fmt.Sprintf("data matches shape %q", policy.Shapes[i]))
+		}
+	}
+	return deny("packed-data", "", "data matches no allowed prefix or shape")
+}
+
+// parseMichelsonType parses a type in Michelson syntax, e.g.
+// "pair (pair chain_id address) (pair nat bytes)"
+func parseMichelsonType(source string) (*Micheline, error) {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(source))
+	ty, rest, err := parseMichelsonTypeTokens(tokens, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %q", strings.Join(rest, " "))
+	}
+	return ty, nil
+}
+
+// parseMichelsonTypeTokens reads one type from the tokens, returning the
+// remaining ones.  Arguments are only read by a type that isn't itself an
+// argument, unless it's wrapped in parentheses.
+func parseMichelsonTypeTokens(tokens []string, withArgs bool) (*Micheline, []string, error) {
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("missing type")
+	}
+	if tokens[0] == "(" {
+		ty, rest, err := parseMichelsonTypeTokens(tokens[1:], true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 || rest[0] != ")" {
+			return nil, nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return ty, rest[1:], nil
+	}
+
+	ty := &Micheline{Kind: michelinePrim, Prim: tokens[0]}
+	if !michelsonValueTypes[ty.Prim] {
+		return nil, nil, fmt.Errorf("unsupported type %v", ty.Prim)
+	}
+	rest := tokens[1:]
+	if !withArgs {
+		if ty.Prim == "pair" || michelsonTypeArity[ty.Prim] > 0 {
+			return nil, nil, fmt.Errorf("arguments of %v must be in parentheses", ty.Prim)
+		}
+		return ty, rest, nil
+	}
+	for len(rest) > 0 && rest[0] != ")" {
+		if ty.Prim != "pair" && len(ty.Args) == michelsonTypeArity[ty.Prim] {
+			break
+		}
+		arg, remaining, err := parseMichelsonTypeTokens(rest, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		ty.Args = append(ty.Args, arg)
+		rest = remaining
+	}
+	if ty.Prim == "pair" && len(ty.Args) < 2 {
+		return nil, nil, fmt.Errorf("pair needs at least 2 arguments")
+	}
+	if ty.Prim == "pair" && ty.Args[len(ty.Args)-1].Prim == "pair" {
+		// Right combs are equivalent to n-ary pairs
+		last := ty.Args[len(ty.Args)-1]
+		ty.Args = append(ty.Args[:len(ty.Args)-1], last.Args...)
+	}
+	if ty.Prim != "pair" && len(ty.Args) != michelsonTypeArity[ty.Prim] {
+		return nil, nil, fmt.Errorf("%v needs %v arguments", ty.Prim, michelsonTypeArity[ty.Prim])
+	}
+	return ty, rest, nil
+}
+
+// matchesShape is true if the value is of the Michelson type
+func matchesShape(value *Micheline, ty *Micheline) bool {
+	switch ty.Prim {
+	case "unit":
+		return value.IsPrim("Unit", 0)
+	case "bool":
+		return value.IsPrim("True", 0) || value.IsPrim("False", 0)
+	case "int":
+		return value.Kind == michelineInt
+	case "nat", "mutez":
+		return isNat(value)
+	case "string":
+		return value.Kind == michelineString
+	case "bytes":
+		return value.Kind == michelineBytes
+	case "timestamp":
+		return value.Kind == michelineInt || value.Kind == michelineString
+	case "address", "key_hash", "key", "signature", "chain_id":
+		return value.Kind == michelineString || value.Kind == michelineBytes
+	case "pair":
+		args := pairArgs(value, len(ty.Args))
+		if args == nil {
+			return false
+		}
+		for i, arg := range args {
+			if !matchesShape(arg, ty.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case "option":
+		return value.IsPrim("None", 0) || (value.IsPrim("Some", 1) && matchesShape(value.Args[0], ty.Args[0]))
+	case "or":
+		return (value.IsPrim("Left", 1) && matchesShape(value.Args[0], ty.Args[0])) ||
+			(value.IsPrim("Right", 1) && matchesShape(value.Args[0], ty.Args[1]))
+	case "list", "set":
+		if value.Kind != michelineSeq {
+			return false
+		}
+		for _, element := range value.Args {
+			if !matchesShape(element, ty.Args[0]) {
+				return false
+			}
+		}
+		return true
+	case "map":
+		if value.Kind != michelineSeq {
+			return false
+		}
+		for _, element := range value.Args {
+			if !element.IsPrim("Elt", 2) || !matchesShape(element.Args[0], ty.Args[0]) || !matchesShape(element.Args[1], ty.Args[1]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
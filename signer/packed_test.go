@@ -0,0 +1,99 @@
+package signer
+
+import (
+	"encoding/hex"
+	"log"
+	"net/http"
+	"testing"
+)
+
+const testLoginPrefix = "Tezos Signed Message: example.com "
+
+// testPermit forges the packed parameters of a TZIP-17 permit:
+// (pair (pair address chain_id) (pair nat bytes))
+func testPermit() string {
+	contract := testMichelineBytes("016e7c23cc06c7b0743256f65e34d5b0f7c91e4eb200")
+	chainID := testMichelineBytes("7a06a770")
+	hash := testMichelineBytes("3a1f46a1d6a3cc1ae4fbcd38a8eb89df2ff4f29a2ee5a2df4fa8a4f1a9fc6d39")
+	return testMichelinePair(testMichelinePair(contract, chainID), testMichelinePair("0001", hash))
+}
+
+func TestParseMichelsonType(t *testing.T) {
+	valid := []string{
+		"string",
+		"pair (pair address chain_id) (pair nat bytes)",
+		"pair address chain_id nat bytes",
+		"(list (or (pair key_hash mutez) unit))",
+		"map string (option int)",
+	}
+	for _, shape := range valid {
+		if _, err := parseMichelsonType(shape); err != nil {
+			log.Printf("[Michelson Type Test] Unable to parse %q: %v\n", shape, err)
+			t.Fail()
+		}
+	}
+	invalid := []string{"", "pair nat", "list", "option nat nat", "pair (list nat", "list list nat", "lambda unit unit", "nat )"}
+	for _, shape := range invalid {
+		if _, err := parseMichelsonType(shape); err == nil {
+			log.Printf("[Michelson Type Test] Expected %q to be invalid\n", shape)
+			t.Fail()
+		}
+	}
+}
+
+func TestPackedDataPolicy(t *testing.T) {
+	policy := &PackedDataPolicy{
+		StringPrefixes: []string{testLoginPrefix},
+		Shapes:         []string{"pair (pair address chain_id) (pair nat bytes)"},
+	}
+	policy.parseShapes()
+
+	tests := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{"Login", testMichelineString(testLoginPrefix + "2026-10-18T00:00:00Z login"), true},
+		{"Other String", testMichelineString("Tezos Signed Message: evil.com"), false},
+		{"Permit", testPermit(), true},
+		{"Permit With Int Counter", testMichelinePair(testMichelinePair(testMichelineString("KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp"), testMichelineString("NetXdQprcVkpaWU")), testMichelinePair("0041", testMichelineBytes("00"))), false},
+		{"Nat", "0001", false},
+	}
+	for _, test := range tests {
+		bytes, _ := hex.DecodeString(test.data)
+		data, err := decodeMichelineBytes(bytes)
+		if err != nil {
+			log.Printf("[Packed Data Test - %v] Unable to decode: %v\n", test.name, err)
+			t.Fail()
+			continue
+		}
+		if policy.evaluate(data).Allowed != test.expected {
+			log.Printf("[Packed Data Test - %v] Expected allowed to be %v\n", test.name, test.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestPostPackedData(t *testing.T) {
+	server := getTestServer("tz123")
+	login := testEndorse
+	login.Operation = "\"05" + testMichelineString(testLoginPrefix+"login") + "\""
+
+	// Disabled by default, even with every generic operation enabled
+	server.filter.EnableGeneric = true
+	resp, body := testPost(t, server, login)
+	compare(t, "Packed Data Disabled", resp.StatusCode, http.StatusForbidden, body, login.SignerResponse)
+
+	server.keys[0].PackedData = &PackedDataPolicy{StringPrefixes: []string{testLoginPrefix}}
+	server.keys[0].PackedData.parseShapes()
+	resp, body = testPost(t, server, login)
+	compare(t, "Packed Data Login #1", resp.StatusCode, http.StatusOK, body, login.SignerResponse)
+	// Packed data has no level to watermark
+	resp, body = testPost(t, server, login)
+	compare(t, "Packed Data Login #2", resp.StatusCode, http.StatusOK, body, login.SignerResponse)
+
+	permit := login
+	permit.Operation = "\"05" + testPermit() + "\""
+	resp, body = testPost(t, server, permit)
+	compare(t, "Packed Data Permit", resp.StatusCode, http.StatusForbidden, body, permit.SignerResponse)
+}
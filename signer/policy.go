@@ -0,0 +1,230 @@
+package signer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Actions of policy rules
+const (
+	policyActionAllow = "allow"
+	policyActionDeny  = "deny"
+)
+
+// PolicyRule allows or denies the operations it matches.  Every field that is
+// set must match.  Generic operations are matched content by content, other
+// operations match Kinds by their type, e.g. "block", "tenderbake_endorsement"
+// or "packed_data".  Amounts and fees are in XTZ.
+type PolicyRule struct {
+	Name         string          `yaml:"Name"`
+	Action       string          `yaml:"Action"`
+	Keys         []string        `yaml:"Keys"`
+	Chains       []string        `yaml:"Chains"`
+	MagicBytes   []uint8         `yaml:"MagicBytes"`
+	Kinds        []OperationKind `yaml:"Kinds"`
+	Sources      []string        `yaml:"Sources"`
+	Destinations []string        `yaml:"Destinations"`
+	MinAmount    string          `yaml:"MinAmount"`
+	MaxAmount    string          `yaml:"MaxAmount"`
+	MaxFee       string          `yaml:"MaxFee"`
+	Entrypoints  []string        `yaml:"Entrypoints"`
+
+	// Amounts in uXTZ
+	minAmount *big.Int
+	maxAmount *big.Int
+	maxFee    *big.Int
+}
+
+// policySubject is what rules match against: a content of a generic
+// operation, or any other operation as a whole
+type policySubject struct {
+	name        string
+	kind        OperationKind
+	source      string
+	destination string
+	entrypoint  string
+	amount      *big.Int
+	fee         *big.Int
+}
+
+// LoadPolicyFile loads ordered policy rules from a file
+func LoadPolicyFile(file string) []*PolicyRule {
+	rules := []*PolicyRule{}
+
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln("Unable to read file: " + file)
+	}
+	err = yaml.Unmarshal(yamlFile, &rules)
+	if err != nil {
+		log.Fatalln("Unable to parse yaml file: " + file)
+	}
+	for i, rule := range rules {
+		if len(rule.Name) == 0 {
+			rule.Name = fmt.Sprintf("#%v", i+1)
+		}
+		if err := rule.parse(); err != nil {
+			log.Fatalf("Invalid policy rule %v: %v\n", rule.Name, err)
+		}
+	}
+	return rules
+}
+
+// parse the action and amounts of the rule
+func (rule *PolicyRule) parse() error {
+	if rule.Action != policyActionAllow && rule.Action != policyActionDeny {
+		return fmt.Errorf("action must be %v or %v, not %q", policyActionAllow, policyActionDeny, rule.Action)
+	}
+	var err error
+	if rule.minAmount, err = ParseTez(rule.MinAmount); err != nil {
+		return fmt.Errorf("invalid MinAmount: %v", err)
+	}
+	if rule.maxAmount, err = ParseTez(rule.MaxAmount); err != nil {
+		return fmt.Errorf("invalid MaxAmount: %v", err)
+	}
+	if rule.maxFee, err = ParseTez(rule.MaxFee); err != nil {
+		return fmt.Errorf("invalid MaxFee: %v", err)
+	}
+	return nil
+}
+
+// ParseTez converts an amount of XTZ, e.g. "0.5", to uXTZ.  Empty amounts
+// are nil.
+func ParseTez(amount string) (*big.Int, error) {
+	if len(amount) == 0 {
+		return nil, nil
+	}
+	tez, ok := new(big.Rat).SetString(amount)
+	if !ok || tez.Sign() < 0 {
+		return nil, fmt.Errorf("%q is not an amount of XTZ", amount)
+	}
+	mutez := tez.Mul(tez, new(big.Rat).SetInt64(1000000))
+	if !mutez.IsInt() {
+		return nil, fmt.Errorf("%q is more precise than 1 uXTZ", amount)
+	}
+	return mutez.Num(), nil
+}
+
+// evaluatePolicy of the operation.  The first rule matching each subject
+// decides it, and subjects no rule matches are denied.
+func (filter *OperationFilter) evaluatePolicy(op *Operation, key *Key) []*FilterDecision {
+	subjects, err := policySubjects(op)
+	if err != nil {
+		return []*FilterDecision{denyWith(ReasonParseError, "decode", "", "unable to decode every content of the batch: "+err.Error())}
+	}
+	chainID := ""
+	if hasChainID(op.MagicByte()) {
+		chainID = op.ChainID()
+	}
+
+	decisions := []*FilterDecision{}
+	for _, subject := range subjects {
+		decisions = append(decisions, evaluatePolicyRules(filter.PolicyRules, key, chainID, op.MagicByte(), subject))
+	}
+	return decisions
+}
+
+// evaluatePolicyRules in order, returning the decision of the first match
+func evaluatePolicyRules(rules []*PolicyRule, key *Key, chainID string, magicByte uint8, subject *policySubject) *FilterDecision {
+	for _, rule := range rules {
+		if !rule.matches(key, chainID, magicByte, subject) {
+			continue
+		}
+		reason := fmt.Sprintf("rule %v matches with action %v", rule.Name, rule.Action)
+		if rule.Action == policyActionAllow {
+			return allow("policy-file", subject.name, reason)
+		}
+		return deny("policy-file", subject.name, reason)
+	}
+	return deny("policy-file", subject.name, "no rule matches")
+}
+
+// policySubjects of the operation.  Fails if a generic operation can't be
+// fully decoded.
+func policySubjects(op *Operation) ([]*policySubject, error) {
+	if op.MagicByte() != opMagicByteGeneric {
+		return []*policySubject{{kind: OperationKind(magicByteTypes[op.MagicByte()])}}, nil
+	}
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil {
+		return nil, err
+	}
+	subjects := []*policySubject{}
+	for i, content := range contents {
+		subject := contentSubject(content)
+		subject.name = fmt.Sprintf("content %v (%v)", i, content.Kind())
+		subjects = append(subjects, subject)
+	}
+	return subjects, nil
+}
+
+// contentSubject with the fields of the content that rules match
+func contentSubject(content OperationContent) *policySubject {
+	subject := &policySubject{kind: content.Kind()}
+	if manager := managerOf(content); manager != nil {
+		subject.source = manager.Source
+		subject.fee = manager.Fee
+	}
+	switch c := content.(type) {
+	case *Transaction:
+		subject.destination = c.Destination
+		subject.amount = c.Amount
+		subject.entrypoint = "default"
+		if c.Parameters != nil {
+			subject.entrypoint = c.Parameters.Entrypoint
+		}
+	case *Delegation:
+		subject.destination = c.Delegate
+	case *Origination:
+		subject.amount = c.Balance
+	case *TransferTicket:
+		subject.destination = c.Destination
+		subject.entrypoint = c.Entrypoint
+	case *DrainDelegate:
+		subject.destination = c.Destination
+	case *Ballot:
+		subject.source = c.Source
+	case *Proposals:
+		subject.source = c.Source
+	}
+	return subject
+}
+
+// matches is true if every field set in the rule matches the subject
+func (rule *PolicyRule) matches(key *Key, chainID string, magicByte uint8, subject *policySubject) bool {
+	if rule.Keys != nil && (key == nil || !(containsString(rule.Keys, key.Name) || containsString(rule.Keys, key.PublicKeyHash))) {
+		return false
+	}
+	if rule.Chains != nil && !containsString(rule.Chains, chainID) {
+		return false
+	}
+	if rule.MagicBytes != nil && !containsMagicByte(rule.MagicBytes, magicByte) {
+		return false
+	}
+	if rule.Kinds != nil && !containsKind(rule.Kinds, subject.kind) {
+		return false
+	}
+	if rule.Sources != nil && !containsString(rule.Sources, subject.source) {
+		return false
+	}
+	if rule.Destinations != nil && !containsString(rule.Destinations, subject.destination) {
+		return false
+	}
+	if rule.Entrypoints != nil && !containsString(rule.Entrypoints, subject.entrypoint) {
+		return false
+	}
+	if rule.minAmount != nil && (subject.amount == nil || subject.amount.Cmp(rule.minAmount) < 0) {
+		return false
+	}
+	if rule.maxAmount != nil && (subject.amount == nil || subject.amount.Cmp(rule.maxAmount) > 0) {
+		return false
+	}
+	if rule.maxFee != nil && (subject.fee == nil || subject.fee.Cmp(rule.maxFee) > 0) {
+		return false
+	}
+	return true
+}
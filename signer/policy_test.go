@@ -0,0 +1,106 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"testing"
+)
+
+const (
+	testPolicyBaker = "tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"
+	testPolicyCold  = "tz3bh5VbXnLMyHGUMfhRKYzVXQE1axzTm9FN"
+)
+
+// testZarith encodes a natural number as zarith
+func testZarith(n uint64) string {
+	encoded := ""
+	for n >= 0x80 {
+		encoded += fmt.Sprintf("%02x", n&0x7f|0x80)
+		n >>= 7
+	}
+	return encoded + fmt.Sprintf("%02x", n)
+}
+
+// testPolicyTransfer forges a transfer from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m
+// to the baker (tz1) or cold storage (tz3)
+func testPolicyTransfer(cold bool, amount uint64, fee uint64) string {
+	destination := "00008c947bf65254cf1a813eb8c6d3f980a89751e2af"
+	if cold {
+		destination = "0002a88430950b81e860bc6d7cec866864e46a667819"
+	}
+	return "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+		"6c0154f5d8f71ce18f9f05bb885a4120e64c667bc1b4" + testZarith(fee) + "0203" + "04" + testZarith(amount) + destination + "00\""
+}
+
+// testPolicyDelegation forges a delegation from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m
+// to the baker (tz1) or cold storage (tz3)
+func testPolicyDelegation(baker bool) string {
+	delegate := "02a88430950b81e860bc6d7cec866864e46a667819"
+	if baker {
+		delegate = "008c947bf65254cf1a813eb8c6d3f980a89751e2af"
+	}
+	return "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f" +
+		"6e0154f5d8f71ce18f9f05bb885a4120e64c667bc1b4010203" + "04ff" + delegate + "\""
+}
+
+func testPolicyRules(t *testing.T) []*PolicyRule {
+	rules := []*PolicyRule{
+		{Name: "consensus", Action: "allow", MagicBytes: []uint8{opMagicByteEndorsement}, Chains: []string{testEndorse.ChainID}},
+		{Name: "our-baker", Action: "allow", Kinds: []OperationKind{opKindDelegation}, Destinations: []string{testPolicyBaker}},
+		{Name: "cold-storage", Action: "allow", Kinds: []OperationKind{opKindTransaction}, Destinations: []string{testPolicyCold}},
+		{Name: "small-transfers", Action: "allow", Kinds: []OperationKind{opKindTransaction}, MaxAmount: "100", MaxFee: "0.01"},
+		{Name: "payout-key", Action: "allow", Keys: []string{"payouts"}, Kinds: []OperationKind{opKindTransaction}},
+	}
+	for _, rule := range rules {
+		if err := rule.parse(); err != nil {
+			log.Printf("Invalid test rule %v: %v\n", rule.Name, err)
+			t.Fail()
+		}
+	}
+	return rules
+}
+
+func TestPolicyRules(t *testing.T) {
+	filter := &OperationFilter{PolicyRules: testPolicyRules(t)}
+	payouts := &Key{Name: "payouts"}
+
+	tests := []struct {
+		Name      string
+		Key       *Key
+		Operation string
+		Expected  bool
+	}{
+		{"Endorsement", nil, testEndorse.Operation, true},
+		{"Block", nil, testBlock.Operation, false},
+		{"Delegate To Baker", nil, testPolicyDelegation(true), true},
+		{"Delegate Elsewhere", nil, testPolicyDelegation(false), false},
+		{"Small Transfer", nil, testPolicyTransfer(false, 100000000, 1000), true},
+		{"Small Transfer High Fee", nil, testPolicyTransfer(false, 100000000, 10001), false},
+		{"Large Transfer", nil, testPolicyTransfer(false, 100000001, 1000), false},
+		{"Large Transfer To Cold", nil, testPolicyTransfer(true, 500000000, 1000), true},
+		{"Large Transfer With Key", payouts, testPolicyTransfer(false, 500000000, 1000), true},
+		{"Ballot", nil, "\"03ce69c5713dac3537254e7be59759cf59c15abd530d10501ccf9028a5786314cf0600531ab5764a29f77c5d40b80a5da45c84468f08a10000000bab22e46e7872aa13e366e455bb4f5dbede856ab0864e1da7e122554579ee71f800\"", false},
+	}
+	for _, test := range tests {
+		testKeyPolicy(t, "[Policy Test - "+test.Name+"]", filter, test.Key, test.Operation, test.Expected)
+	}
+}
+
+func TestPolicyRuleParse(t *testing.T) {
+	tests := []struct {
+		Rule  PolicyRule
+		Valid bool
+	}{
+		{PolicyRule{Action: "allow", MaxAmount: "0.000001"}, true},
+		{PolicyRule{Action: "deny", MinAmount: "100", MaxFee: "0.5"}, true},
+		{PolicyRule{Action: "permit"}, false},
+		{PolicyRule{Action: "allow", MaxAmount: "0.0000001"}, false},
+		{PolicyRule{Action: "allow", MaxFee: "-1"}, false},
+	}
+	for i, test := range tests {
+		if err := test.Rule.parse(); (err == nil) != test.Valid {
+			log.Printf("[Policy Parse Test #%v] Expected valid to be %v: %v\n", i, test.Valid, err)
+			t.Fail()
+		}
+	}
+}
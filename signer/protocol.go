@@ -0,0 +1,211 @@
+package signer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OperationKind identifies the content of a generic operation independently
+// of the tag a given protocol serializes it with
+type OperationKind string
+
+// Kinds of generic operation contents, named as in `tezos-client describe
+// unsigned operation`
+const (
+	opKindEndorsement                 OperationKind = "endorsement"
+	opKindEndorsementWithSlot         OperationKind = "endorsement_with_slot"
+	opKindPreendorsement              OperationKind = "preendorsement"
+	opKindAttestation                 OperationKind = "attestation"
+	opKindAttestationWithDal          OperationKind = "attestation_with_dal"
+	opKindPreattestation              OperationKind = "preattestation"
+	opKindSeedNonceRevelation         OperationKind = "seed_nonce_revelation"
+	opKindVdfRevelation               OperationKind = "vdf_revelation"
+	opKindDoubleEndorsement           OperationKind = "double_endorsement_evidence"
+	opKindDoublePreendorsement        OperationKind = "double_preendorsement_evidence"
+	opKindDoubleAttestation           OperationKind = "double_attestation_evidence"
+	opKindDoublePreattestation        OperationKind = "double_preattestation_evidence"
+	opKindDoubleBakingEvidence        OperationKind = "double_baking_evidence"
+	opKindActivateAccount             OperationKind = "activate_account"
+	opKindProposal                    OperationKind = "proposals"
+	opKindBallot                      OperationKind = "ballot"
+	opKindDrainDelegate               OperationKind = "drain_delegate"
+	opKindFailingNoop                 OperationKind = "failing_noop"
+	opKindReveal                      OperationKind = "reveal"
+	opKindTransaction                 OperationKind = "transaction"
+	opKindOrigination                 OperationKind = "origination"
+	opKindDelegation                  OperationKind = "delegation"
+	opKindRegisterGlobalConstant      OperationKind = "register_global_constant"
+	opKindSetDepositsLimit            OperationKind = "set_deposits_limit"
+	opKindIncreasePaidStorage         OperationKind = "increase_paid_storage"
+	opKindUpdateConsensusKey          OperationKind = "update_consensus_key"
+	opKindTransferTicket              OperationKind = "transfer_ticket"
+	opKindSmartRollupOriginate        OperationKind = "smart_rollup_originate"
+	opKindSmartRollupAddMessages      OperationKind = "smart_rollup_add_messages"
+	opKindSmartRollupCement           OperationKind = "smart_rollup_cement"
+	opKindSmartRollupPublish          OperationKind = "smart_rollup_publish"
+	opKindSmartRollupRefute           OperationKind = "smart_rollup_refute"
+	opKindSmartRollupTimeout          OperationKind = "smart_rollup_timeout"
+	opKindSmartRollupExecuteOutboxMsg OperationKind = "smart_rollup_execute_outbox_message"
+	opKindSmartRollupRecoverBond      OperationKind = "smart_rollup_recover_bond"
+	opKindDalPublishSlotHeader        OperationKind = "dal_publish_slot_header"
+	opKindDalPublishCommitment        OperationKind = "dal_publish_commitment"
+	opKindUnknown                     OperationKind = "unknown"
+)
+
+// Protocol maps the operation tags of a Tezos protocol to their kinds
+type Protocol struct {
+	Name string
+	Hash string
+	// CostPerByte of storage burnt, in uXTZ
+	CostPerByte int64
+	tags        map[uint8]OperationKind
+}
+
+// Kind of the operation serialized with this tag, or opKindUnknown
+func (protocol *Protocol) Kind(tag uint8) OperationKind {
+	if kind, ok := protocol.tags[tag]; ok {
+		return kind
+	}
+	return opKindUnknown
+}
+
+// Tag this protocol serializes the kind with
+func (protocol *Protocol) Tag(kind OperationKind) (uint8, bool) {
+	for tag, k := range protocol.tags {
+		if k == kind {
+			return tag, true
+		}
+	}
+	return 0, false
+}
+
+// amend a tag table, copying the previous protocol's tags.  Kinds mapped to
+// opKindUnknown are removed.
+func amend(previous map[uint8]OperationKind, changes map[uint8]OperationKind) map[uint8]OperationKind {
+	tags := map[uint8]OperationKind{}
+	for tag, kind := range previous {
+		tags[tag] = kind
+	}
+	for tag, kind := range changes {
+		if kind == opKindUnknown {
+			delete(tags, tag)
+		} else {
+			tags[tag] = kind
+		}
+	}
+	return tags
+}
+
+// Operation tags as they changed across protocol upgrades.  Defined in each
+// protocol's lib_protocol/operation_repr.ml, e.g.
+// https://gitlab.com/tezos/tezos/blob/master/src/proto_005_PsBABY5H/lib_protocol/operation_repr.ml#L548
+var (
+	babylonTags = map[uint8]OperationKind{
+		0x00: opKindEndorsement,
+		0x01: opKindSeedNonceRevelation,
+		0x02: opKindDoubleEndorsement,
+		0x03: opKindDoubleBakingEvidence,
+		0x04: opKindActivateAccount,
+		0x05: opKindProposal,
+		0x06: opKindBallot,
+		0x6b: opKindReveal,
+		0x6c: opKindTransaction,
+		0x6d: opKindOrigination,
+		0x6e: opKindDelegation,
+	}
+	edoTags = amend(babylonTags, map[uint8]OperationKind{
+		0x0a: opKindEndorsementWithSlot,
+		0x11: opKindFailingNoop,
+	})
+	hangzhouTags = amend(edoTags, map[uint8]OperationKind{
+		0x6f: opKindRegisterGlobalConstant,
+	})
+	ithacaTags = amend(hangzhouTags, map[uint8]OperationKind{
+		0x00: opKindUnknown,
+		0x0a: opKindUnknown,
+		0x07: opKindDoublePreendorsement,
+		0x14: opKindPreendorsement,
+		0x15: opKindEndorsement,
+		0x70: opKindSetDepositsLimit,
+	})
+	jakartaTags = amend(ithacaTags, map[uint8]OperationKind{
+		0x9e: opKindTransferTicket,
+	})
+	kathmanduTags = amend(jakartaTags, map[uint8]OperationKind{
+		0x08: opKindVdfRevelation,
+		0x71: opKindIncreasePaidStorage,
+	})
+	limaTags = amend(kathmanduTags, map[uint8]OperationKind{
+		0x09: opKindDrainDelegate,
+		0x72: opKindUpdateConsensusKey,
+	})
+	mumbaiTags = amend(limaTags, map[uint8]OperationKind{
+		0xc8: opKindSmartRollupOriginate,
+		0xc9: opKindSmartRollupAddMessages,
+		0xca: opKindSmartRollupCement,
+		0xcb: opKindSmartRollupPublish,
+		0xcc: opKindSmartRollupRefute,
+		0xcd: opKindSmartRollupTimeout,
+		0xce: opKindSmartRollupExecuteOutboxMsg,
+		0xcf: opKindSmartRollupRecoverBond,
+		0xe6: opKindDalPublishSlotHeader,
+	})
+	oxfordTags = amend(mumbaiTags, map[uint8]OperationKind{
+		0x02: opKindDoubleAttestation,
+		0x07: opKindDoublePreattestation,
+		0x14: opKindPreattestation,
+		0x15: opKindAttestation,
+		0x70: opKindUnknown,
+	})
+	parisTags = amend(oxfordTags, map[uint8]OperationKind{
+		0x17: opKindAttestationWithDal,
+		0xe6: opKindDalPublishCommitment,
+	})
+)
+
+// Protocols whose operation tags are known, oldest first
+var protocols = []*Protocol{
+	{Name: "babylon", Hash: "PsBabyM1eUXZseaJdmXFApDSBqj8YBfwELoxZHHW77EMcAbbwAS", CostPerByte: 1000, tags: babylonTags},
+	{Name: "carthage", Hash: "PsCARTHAGazKbHtnKfLzQg3kms52kSRpgnDY982a9oYsSXRLQEb", CostPerByte: 1000, tags: babylonTags},
+	{Name: "delphi", Hash: "PsDELPH1Kxsxt8f9eWbxQeRxkjfbxoqM52jvs5Y5fBxWWh4ifpo", CostPerByte: 250, tags: babylonTags},
+	{Name: "edo", Hash: "PtEdo2ZkT9oKpimTah6x2embF25oss54njMuPzkJTEi5RqfdZFA", CostPerByte: 250, tags: edoTags},
+	{Name: "florence", Hash: "PsFLorenaUUuikDWvMDr6fGBRG8kt3e3D3fHoXK1j1BFRxeSH4i", CostPerByte: 250, tags: edoTags},
+	{Name: "granada", Hash: "PtGRANADsDU8R9daYKAgWnQYAJ64omN1o3KMGVCykShA97vQbvV", CostPerByte: 250, tags: edoTags},
+	{Name: "hangzhou", Hash: "PtHangz2aRngywmSRGGvrcTyMbbdpWdpFKuS4uMWxg2RaH9i1qx", CostPerByte: 250, tags: hangzhouTags},
+	{Name: "ithaca", Hash: "Psithaca2MLRFYargivpo7YvUr7wUDqyxrdhC5CQq78mRvimz6A", CostPerByte: 250, tags: ithacaTags},
+	{Name: "jakarta", Hash: "PtJakart2xVj7pYXJBXrqHgd82rdkLey5ZeeGwDgPp9rhQUbSqY", CostPerByte: 250, tags: jakartaTags},
+	{Name: "kathmandu", Hash: "PtKathmankSpLLDALzWw7CGD2j2MtyveTwboEYokqUCP4a1LxMg", CostPerByte: 250, tags: kathmanduTags},
+	{Name: "lima", Hash: "PtLimaPtLMwfNinJi9rCfDPWea8dFgTZ1MeJ9f1m2SRic6ayiwW", CostPerByte: 250, tags: limaTags},
+	{Name: "mumbai", Hash: "PtMumbai2TmsJHNGRkD8v8YDbtao7BLUC3VmQEb3BtNUXBvkNia", CostPerByte: 250, tags: mumbaiTags},
+	{Name: "nairobi", Hash: "PtNairobiyssHuh87hEhfVBGCVrK3WnS8Z2FT4ymB5tAa4r1nQf", CostPerByte: 250, tags: mumbaiTags},
+	{Name: "oxford", Hash: "ProxfordYmVfjWnRcgjWH36fW6PArwqykTFzotUxRs6gmTcZDuH", CostPerByte: 250, tags: oxfordTags},
+	{Name: "paris", Hash: "PtParisBxoLz5gzMmn3d9WBQNoPSZakgnkMC2VNuQ3KXfUtUQeZ", CostPerByte: 250, tags: parisTags},
+	{Name: "parisc", Hash: "PsParisCZo7KAh1Z1smVd9ZMZ1HHn5gkzbM94V3PLCpknFWhUAi", CostPerByte: 250, tags: parisTags},
+	{Name: "quebec", Hash: "PsQuebecnLByd3JwTiGadoG4nGWi3HYiLXUjkibeFV8dCFeVMUg", CostPerByte: 250, tags: parisTags},
+}
+
+// activeProtocol decodes generic operations.  Defaults to the latest protocol.
+var activeProtocol = protocols[len(protocols)-1]
+
+// GetProtocol by name, e.g. "quebec", or by full or abbreviated hash
+func GetProtocol(nameOrHash string) (*Protocol, error) {
+	for _, protocol := range protocols {
+		if strings.EqualFold(protocol.Name, nameOrHash) {
+			return protocol, nil
+		}
+		if len(nameOrHash) >= 8 && strings.HasPrefix(protocol.Hash, nameOrHash) {
+			return protocol, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown protocol %v", nameOrHash)
+}
+
+// SetProtocol used to identify generic operation kinds
+func SetProtocol(nameOrHash string) error {
+	protocol, err := GetProtocol(nameOrHash)
+	if err != nil {
+		return err
+	}
+	activeProtocol = protocol
+	return nil
+}
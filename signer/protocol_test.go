@@ -0,0 +1,67 @@
+package signer
+
+import (
+	"log"
+	"testing"
+)
+
+func TestProtocolTags(t *testing.T) {
+	tests := []struct {
+		protocol string
+		tag      uint8
+		kind     OperationKind
+	}{
+		{"babylon", 0x03, opKindDoubleBakingEvidence},
+		{"babylon", 0x04, opKindActivateAccount},
+		{"babylon", 0x6c, opKindTransaction},
+		{"babylon", 0x6d, opKindOrigination},
+		{"babylon", 0x15, opKindUnknown},
+		{"ithaca", 0x15, opKindEndorsement},
+		{"ithaca", 0x70, opKindSetDepositsLimit},
+		{"lima", 0x72, opKindUpdateConsensusKey},
+		{"lima", 0x09, opKindDrainDelegate},
+		{"oxford", 0x15, opKindAttestation},
+		{"oxford", 0x70, opKindUnknown},
+		{"quebec", 0xc8, opKindSmartRollupOriginate},
+		{"PsQuebecnLByd3JwTiGadoG4nGWi3HYiLXUjkibeFV8dCFeVMUg", 0x71, opKindIncreasePaidStorage},
+		{"PtParisB", 0xe6, opKindDalPublishCommitment},
+	}
+	for _, test := range tests {
+		protocol, err := GetProtocol(test.protocol)
+		if err != nil {
+			log.Printf("Unable to find protocol %v: %v\n", test.protocol, err)
+			t.Fail()
+			continue
+		}
+		if protocol.Kind(test.tag) != test.kind {
+			log.Printf("Protocol %v: expected tag 0x%02x to be %v, received %v\n", test.protocol, test.tag, test.kind, protocol.Kind(test.tag))
+			t.Fail()
+		}
+	}
+
+	if _, err := GetProtocol("Ps"); err == nil {
+		log.Println("A short protocol hash prefix should not match")
+		t.Fail()
+	}
+}
+
+func TestSetProtocol(t *testing.T) {
+	defer func(previous *Protocol) { activeProtocol = previous }(activeProtocol)
+
+	// set_deposits_limit from tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m with a limit of 5
+	setDepositsLimit := "\"030c4886e771509274c81d97195d0c6c13a9d96287e7d2ed3b086e0e509a1ade0f700154f5d8f71ce18f9f05bb885a4120e64c667bc1b401020304ff05\""
+	op, _ := ParseOperation([]byte(setDepositsLimit))
+
+	SetProtocol("ithaca")
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil || contents[0].Kind() != opKindSetDepositsLimit || contents[0].(*SetDepositsLimit).Limit.Int64() != 5 {
+		log.Println("set_deposits_limit should decode in ithaca:", err)
+		t.Fail()
+	}
+
+	SetProtocol("oxford")
+	if _, err := GetGenericOperation(op).Contents(); err == nil {
+		log.Println("set_deposits_limit should not decode after it was removed in oxford")
+		t.Fail()
+	}
+}
@@ -0,0 +1,105 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Reason codes of signing decisions.  These are stable and safe to match on.
+const (
+	ReasonAllowed       = "allowed"
+	ReasonFiltered      = "filtered"
+	ReasonLimitExceeded = "limit_exceeded"
+	ReasonWatermark     = "watermark"
+	ReasonParseError    = "parse_error"
+	ReasonBackendError  = "backend_error"
+	ReasonBadRequest    = "bad_request"
+	ReasonKeyNotFound   = "key_not_found"
+	ReasonNotFound      = "not_found"
+	ReasonPending       = "pending"
+	ReasonUnauthorized  = "unauthorized"
+)
+
+// SignError explains why a request wasn't signed.  It's the JSON body of
+// error responses.
+type SignError struct {
+	Code    string `json:"code"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"error"`
+	// ID of the pending request to poll
+	ID string `json:"id,omitempty"`
+
+	// HTTP status of the response
+	status int
+}
+
+func (err *SignError) Error() string {
+	if len(err.Rule) > 0 {
+		return fmt.Sprintf("%v (%v): %v", err.Code, err.Rule, err.Message)
+	}
+	return err.Code + ": " + err.Message
+}
+
+// signError with the code and HTTP status
+func signError(status int, code string, message string) *SignError {
+	return &SignError{Code: code, Message: message, status: status}
+}
+
+// blockedError from the decision that blocked an operation
+func blockedError(decision *FilterDecision) *SignError {
+	status := http.StatusForbidden
+	if decision.Code == ReasonBackendError {
+		status = http.StatusInternalServerError
+	}
+	return &SignError{Code: decision.Code, Rule: decision.Rule, Message: decision.Reason, status: status}
+}
+
+// writeError as the JSON body of the response
+func writeError(w http.ResponseWriter, err *SignError) {
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// logDecision about signing the operation with the key, and why
+func logDecision(key *Key, op *Operation, code string, rule string, message string) {
+	fields := []string{"code=" + code}
+	if len(rule) > 0 {
+		fields = append(fields, "rule="+rule)
+	}
+	if key != nil {
+		fields = append(fields, "key="+key.PublicKeyHash)
+	}
+	if op != nil {
+		fields = append(fields, "kind="+operationKinds(op))
+		if hasChainID(op.MagicByte()) {
+			fields = append(fields, "chain="+op.ChainID())
+			if level := op.Level(); level != nil {
+				fields = append(fields, "level="+level.String())
+			}
+		}
+	}
+	severity := "[WARN]"
+	if code == ReasonAllowed {
+		severity = "[INFO]"
+	}
+	log.Printf("%v %v: %v\n", severity, strings.Join(fields, " "), message)
+}
+
+// operationKinds of the operation, or of every content of a generic one
+func operationKinds(op *Operation) string {
+	if op.MagicByte() != opMagicByteGeneric {
+		return magicByteTypes[op.MagicByte()]
+	}
+	contents, err := GetGenericOperation(op).Contents()
+	if err != nil {
+		return magicByteTypes[op.MagicByte()]
+	}
+	kinds := []string{}
+	for _, content := range contents {
+		kinds = append(kinds, string(content.Kind()))
+	}
+	return strings.Join(kinds, ",")
+}
@@ -1,6 +1,8 @@
 package signer
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,6 +11,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/siler23/tezos-hsm-signer/signer/watermark"
 )
@@ -18,12 +21,22 @@ type Server struct {
 	signer     Signer
 	keys       []Key
 	bindString string
-	filter     OperationFilter
+	filter     *OperationFilter
 	watermark  watermark.Watermark
+
+	// Generic operations don't include a chain ID, so their counters are
+	// watermarked under this one
+	genericChainID string
+	// Requests held until they're approved, if any
+	approvals *ApprovalQueue
+	// Keys that must authenticate sign requests, if required
+	authorizedKeys []*AuthorizedKey
+	// Serves over TLS if set
+	tls *TLSConfig
 }
 
 // NewServer returns a new server
-func NewServer(signer Signer, keys []Key, bindString string, filter OperationFilter, watermark watermark.Watermark) *Server {
+func NewServer(signer Signer, keys []Key, bindString string, filter *OperationFilter, watermark watermark.Watermark) *Server {
 	return &Server{
 		signer:     signer,
 		keys:       keys,
@@ -33,6 +46,21 @@ func NewServer(signer Signer, keys []Key, bindString string, filter OperationFil
 	}
 }
 
+// SetGenericChainID used to watermark the counters of generic operations
+func (server *Server) SetGenericChainID(chainID string) {
+	server.genericChainID = chainID
+}
+
+// SetApprovalQueue holding requests over its threshold until approved
+func (server *Server) SetApprovalQueue(queue *ApprovalQueue) {
+	server.approvals = queue
+}
+
+// RequireAuthentication of sign requests by any of the authorized keys
+func (server *Server) RequireAuthentication(keys []*AuthorizedKey) {
+	server.authorizedKeys = keys
+}
+
 // Middleware sets content type and log path for all requests
 func Middleware(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -46,44 +74,215 @@ func Middleware(f http.HandlerFunc) http.HandlerFunc {
 // RouteUnmatched handles all requests that aren't matched by the below routes
 func RouteUnmatched(w http.ResponseWriter, r *http.Request) {
 	// Route: <anything not matched>
-	// Response Body: `{"error":"not found"}`
+	// Response Body: `{"code": "not_found", "error": "not found"}`
 	// Status: 404
 	// mimetype: "application/json"
 	log.Println(r.URL.Path[1:], "not found")
 
-	w.WriteHeader(http.StatusNotFound)
-	fmt.Fprintf(w, "{\"error\":\"not found\"}")
+	writeError(w, signError(http.StatusNotFound, ReasonNotFound, "not found"))
 
 }
 
-// RouteAuthorizedKeys list all of they keys that we currently support.  We choose to
-// return an empty set to obscure our secrets.
+// RouteAuthorizedKeys lists the hashes of the keys that must authenticate
+// sign requests, like tezos-client signers.  Returns an empty object if
+// authentication isn't required.
 func (server *Server) RouteAuthorizedKeys(w http.ResponseWriter, r *http.Request) {
 	// Route: /authorized_keys
-	// Response Body: `{}`
+	// Response Body: `{}` or `{"authorized_keys": ["tz1...", ...]}`
 	// Status: 200
 	// mimetype: "application/json"
-	fmt.Fprintf(w, "{}")
+	if server.authorizedKeys == nil {
+		fmt.Fprintf(w, "{}")
+		return
+	}
+	hashes := []string{}
+	for _, key := range server.authorizedKeys {
+		hashes = append(hashes, key.publicKeyHash)
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"authorized_keys": hashes})
 }
 
-// RouteKeys validates a /key/ request and routes based on HTTP Method
-func (server *Server) RouteKeys(w http.ResponseWriter, r *http.Request) {
-	requestedKeyHash := strings.Split(r.URL.Path, "/")[2]
+// RouteDescribe decodes a signing request and explains whether the filter
+// allows it, without signing.  The key query parameter judges it by the
+// policy of that key, and is required when authentication is.
+func (server *Server) RouteDescribe(w http.ResponseWriter, r *http.Request) {
+	// Route: /describe?key=<key>&authentication=<signature>
+	// Method: POST
+	// Response Body: `{"magic_byte": "0x03", "type": "generic", ...}`
+	// Status: 200
+	// mimetype: "application/json"
+	if r.Method != "POST" {
+		writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "bad_verb"))
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading POST content: ", err)
+		writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "error reading the request"))
+		return
+	}
 
 	var key *Key
-	for _, k := range server.keys {
-		if k.PublicKeyHash == requestedKeyHash {
-			key = &k
-			break
+	if requestedKeyHash := r.URL.Query().Get("key"); len(requestedKeyHash) > 0 {
+		if key = server.findKey(requestedKeyHash); key == nil {
+			log.Println("Key not found:", requestedKeyHash)
+
+			writeError(w, signError(http.StatusNotFound, ReasonKeyNotFound, "key not found"))
+			return
+		}
+	}
+	if key != nil {
+		if signErr := server.authorizeRequest(r, key, body); signErr != nil {
+			writeError(w, signErr)
+			return
 		}
+	} else if server.authorizedKeys != nil {
+		writeError(w, signError(http.StatusForbidden, ReasonUnauthorized, "authentication requires the key parameter"))
+		return
+	} else if _, signErr := server.connectionSubject(r.TLS); signErr != nil {
+		writeError(w, signErr)
+		return
+	}
+
+	op, err := ParseOperation(body)
+	if err != nil {
+		log.Println("Error parsing describe request: ", err)
+
+		writeError(w, signError(http.StatusBadRequest, ReasonParseError, err.Error()))
+		return
 	}
+	json.NewEncoder(w).Encode(server.filter.DescribeForKey(op, key))
+}
+
+// RoutePending lists, polls, approves, rejects and cancels requests held for
+// approval or a delay.  Clients polling a request must be allowed to use its
+// key and, if required, authenticate it like the original sign request.
+// Votes are authenticated by approvers and cancels by the admin token.
+func (server *Server) RoutePending(w http.ResponseWriter, r *http.Request) {
+	// Route: /pending, /pending/<id>, /pending/<id>/approve, /pending/<id>/reject or /pending/<id>/cancel
+	// Method: GET to list or poll, POST to approve, reject or cancel
+	// Query: `?authentication=<signature>` of the request to poll, if required
+	// Request Body: `{"approver": "tz1...", "signature": "edsig..."}` to approve or reject
+	// Header: `Authorization: Bearer <admin token>` to cancel
+	// Response Body: `{"id": "...", "status": "signed", "signature": "p2sig...", ...}`
+	// Status: 200
+	// mimetype: "application/json"
+	if server.approvals == nil {
+		writeError(w, signError(http.StatusNotFound, ReasonNotFound, "approvals are disabled"))
+		return
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) == 2 && r.Method == "GET" {
+		request := server.approvals.get(path[1])
+		if request == nil {
+			writeError(w, signError(http.StatusNotFound, ReasonNotFound, "no pending request "+path[1]))
+			return
+		}
+		if signErr := server.authorizeRequest(r, server.pendingKey(request), []byte(request.Operation)); signErr != nil {
+			writeError(w, signErr)
+			return
+		}
+	}
+
+	switch {
+	case len(path) == 1 && r.Method == "GET":
+		requests, signErr := server.listPending(r)
+		if signErr != nil {
+			writeError(w, signErr)
+			return
+		}
+		json.NewEncoder(w).Encode(requests)
+	case len(path) == 2 && r.Method == "GET":
+		request, claimed := server.approvals.unlock(path[1])
+		if request == nil {
+			writeError(w, signError(http.StatusNotFound, ReasonNotFound, "no pending request "+path[1]))
+			return
+		}
+		// Polling after the delay signs the request
+		json.NewEncoder(w).Encode(server.signClaimed(r.Context(), request, claimed))
+	case len(path) == 3 && r.Method == "POST" && path[2] == "cancel":
+		request, signErr := server.approvals.cancel(path[1], strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if signErr != nil {
+			log.Println("Cancel refused:", signErr)
+			writeError(w, signErr)
+			return
+		}
+		json.NewEncoder(w).Encode(request)
+	case len(path) == 3 && r.Method == "POST" && (path[2] == "approve" || path[2] == "reject"):
+		vote := struct {
+			Approver  string `json:"approver"`
+			Signature string `json:"signature"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
+			writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "invalid vote: "+err.Error()))
+			return
+		}
+		request, claimed, signErr := server.approvals.vote(path[1], vote.Approver, vote.Signature, path[2] == "approve")
+		if signErr != nil {
+			log.Println("Vote refused:", signErr)
+			writeError(w, signErr)
+			return
+		}
+		// The approval completing the quorum signs the request
+		json.NewEncoder(w).Encode(server.signClaimed(r.Context(), request, claimed))
+	default:
+		writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "bad_verb"))
+	}
+}
 
+// listPending requests of the keys the client may use
+func (server *Server) listPending(r *http.Request) ([]*PendingRequest, *SignError) {
+	subject, signErr := server.connectionSubject(r.TLS)
+	if signErr != nil {
+		return nil, signErr
+	}
+	requests := []*PendingRequest{}
+	for _, request := range server.approvals.list() {
+		if subject == nil || subject.allows(server.pendingKey(request)) {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+// pendingKey of the request, or just its hash if it's no longer configured
+func (server *Server) pendingKey(request *PendingRequest) *Key {
+	if key := server.findKey(request.Key); key != nil {
+		return key
+	}
+	return &Key{PublicKeyHash: request.Key}
+}
+
+// signClaimed requests, returning them with their signature or failure.
+// Requests the caller didn't claim are returned as they are.
+func (server *Server) signClaimed(ctx context.Context, request *PendingRequest, claimed bool) *PendingRequest {
+	if !claimed {
+		return request
+	}
+	key := server.findKey(request.Key)
+	if key == nil {
+		log.Printf("[ERROR] Key %v of request %v is no longer configured\n", request.Key, request.ID)
+		return server.approvals.finish(request.ID, "", signError(http.StatusNotFound, ReasonKeyNotFound, "key "+request.Key+" is no longer configured"))
+	}
+	signed, failure := server.sign(ctx, key, []byte(request.Operation), true)
+	return server.approvals.finish(request.ID, signed, failure)
+}
+
+// RouteKeys validates a /key/ request and routes based on HTTP Method
+func (server *Server) RouteKeys(w http.ResponseWriter, r *http.Request) {
+	requestedKeyHash := strings.Split(r.URL.Path, "/")[2]
+
+	key := server.findKey(requestedKeyHash)
 	if key == nil {
 		log.Println("Key not found:", requestedKeyHash)
 
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Key not found")
+		writeError(w, signError(http.StatusNotFound, ReasonKeyNotFound, "key not found"))
+		return
+	}
+	if signErr := server.authorizeClient(r, key); signErr != nil {
+		writeError(w, signErr)
 		return
 	}
 
@@ -93,11 +292,20 @@ func (server *Server) RouteKeys(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		server.RouteKeysPOST(w, r, key)
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "{\"error\":\"bad_verb\"}")
+		writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "bad_verb"))
 	}
 }
 
+// findKey with the public key hash, or nil if we don't have it
+func (server *Server) findKey(publicKeyHash string) *Key {
+	for i := range server.keys {
+		if server.keys[i].PublicKeyHash == publicKeyHash {
+			return &server.keys[i]
+		}
+	}
+	return nil
+}
+
 // RouteKeysGET returns the corresponding public key to this public key *hash*
 func (server *Server) RouteKeysGET(w http.ResponseWriter, r *http.Request, key *Key) {
 	// Route: /keys/<key>
@@ -112,6 +320,7 @@ func (server *Server) RouteKeysPOST(w http.ResponseWriter, r *http.Request, key
 	// Route: /keys/<key>
 	// Method: POST
 	// Response Body: `{"signature": "p2sig....."}`
+	// Error Body: `{"code": "filtered", "rule": "enable-tx", "error": "transfers are disabled"}`
 	// Status: 200
 	// mimetype: "application/json"
 
@@ -119,55 +328,123 @@ func (server *Server) RouteKeysPOST(w http.ResponseWriter, r *http.Request, key
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Println("Error reading POST content: ", err)
-
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "{\"error\":\"%s\"}", "error reading the request")
+		writeError(w, signError(http.StatusBadRequest, ReasonBadRequest, "error reading the request"))
 		return
 	}
 	debugln("Received sign request: ", string(body))
 
-	// Parse the message
+	if signErr := server.authenticate(key, body, r.URL.Query().Get("authentication")); signErr != nil {
+		writeError(w, signErr)
+		return
+	}
+	signed, signErr := server.sign(r.Context(), key, body, false)
+	if signErr != nil {
+		writeError(w, signErr)
+		return
+	}
+	response := fmt.Sprintf("{\"signature\":\"%s\"}", signed)
+	log.Println("Returning signed message: ", response)
+
+	fmt.Fprintf(w, response)
+}
+
+// authenticate the request to sign the body with the key, if required
+func (server *Server) authenticate(key *Key, body []byte, signature string) *SignError {
+	if server.authorizedKeys == nil {
+		return nil
+	}
 	op, err := ParseOperation(body)
 	if err != nil {
-		log.Println("Error parsing signing request: ", err)
+		logDecision(key, nil, ReasonParseError, "", err.Error())
+		return signError(http.StatusBadRequest, ReasonParseError, err.Error())
+	}
+	name, err := authenticate(server.authorizedKeys, key, op.Hex(), signature)
+	if err != nil {
+		logDecision(key, op, ReasonUnauthorized, "require-authentication", err.Error())
+		signErr := signError(http.StatusForbidden, ReasonUnauthorized, err.Error())
+		signErr.Rule = "require-authentication"
+		return signErr
+	}
+	debugln("Request authenticated by", name)
+	return nil
+}
 
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "{\"error\":\"%s\"}", "error signing the request")
-		return
+// authorizeRequest of the client to act on the body with the key, as for
+// sign requests: its certificate must allow the key and an authorized key
+// must have signed the body, if required
+func (server *Server) authorizeRequest(r *http.Request, key *Key, body []byte) *SignError {
+	if signErr := server.authorizeClient(r, key); signErr != nil {
+		return signErr
+	}
+	return server.authenticate(key, body, r.URL.Query().Get("authentication"))
+}
+
+// sign the request body with the key if every filter rule and watermark
+// allows it.  Approved requests skip the approval queue.  Every decision is
+// logged with its reason code.
+func (server *Server) sign(ctx context.Context, key *Key, body []byte, approved bool) (string, *SignError) {
+	// Parse the message
+	op, err := ParseOperation(body)
+	if err != nil {
+		logDecision(key, nil, ReasonParseError, "", err.Error())
+		return "", signError(http.StatusBadRequest, ReasonParseError, err.Error())
 	}
 
 	// Fail if the opType is disallowed
-	if !server.filter.IsAllowed(op) {
-		// Disallow transactions unless specifically enabled
-		log.Println("Error, operation is blocked by filter")
+	reservation, blocked := server.filter.Authorize(op, key)
+	if blocked != nil {
+		logDecision(key, op, blocked.Code, blocked.Rule, blocked.Reason)
+		return "", blockedError(blocked)
+	}
+	// Release the reserved spends unless the operation is signed
+	defer reservation.Release()
 
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, "{\"error\":\"%s\"}", "operation blocked by filter")
-		return
+	// Hold operations over the approval threshold until they're approved
+	if server.approvals != nil && !approved {
+		if value, held := server.approvals.needsApproval(op, server.filter.costPerByte()); held {
+			request := server.approvals.hold(key, body, value)
+			message := fmt.Sprintf("held as request %v until %v approvals and %v", request.ID, server.approvals.policy.Required, request.Unlocks.Format(time.RFC3339))
+			logDecision(key, op, ReasonPending, "approval-file", message)
+			pending := signError(http.StatusAccepted, ReasonPending, message)
+			pending.Rule, pending.ID = "approval-file", request.ID
+			return "", pending
+		}
 	}
 
-	// Fail if not a generic operation and the watermark is unsafe
-	if op.MagicByte() != opMagicByteGeneric && !server.watermark.IsSafeToSign(key.PublicKeyHash, op.ChainID(), op.MagicByte(), op.Level()) {
-		log.Println("Could not safely sign at this level")
+	// Fail if the operation has a level and the watermark is unsafe
+	if op.MagicByte() != opMagicByteGeneric && op.MagicByte() != opMagicBytePackedData && !server.watermark.IsSafeToSign(key.PublicKeyHash, op.ChainID(), op.MagicByte(), op.Watermark()) {
+		logDecision(key, op, ReasonWatermark, "", "could not safely sign at this level")
+		return "", signError(http.StatusForbidden, ReasonWatermark, "could not safely sign at this level")
+	}
 
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, "{\"error\":\"%s\"}", "could not safely sign at this level")
-		return
+	// Fail if a generic operation reuses a counter of its source
+	if op.MagicByte() == opMagicByteGeneric && !server.isCounterSafe(GetGenericOperation(op)) {
+		logDecision(key, op, ReasonWatermark, "", "could not safely sign with this counter")
+		return "", signError(http.StatusForbidden, ReasonWatermark, "could not safely sign with this counter")
 	}
 
 	// Sign the operation
-	signed, err := op.TzSign(r.Context(), server.signer, key)
+	signed, err := op.TzSign(ctx, server.signer, key)
 	if err != nil {
-		log.Println("Error signing request:", err)
-
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "{\"error\":\"%s\"}", "error signing the request")
-	} else {
-		response := fmt.Sprintf("{\"signature\":\"%s\"}", signed)
-		log.Println("Returning signed message: ", response)
+		logDecision(key, op, ReasonBackendError, "", err.Error())
+		return "", signError(http.StatusInternalServerError, ReasonBackendError, "error signing the request")
+	}
+	// Only count towards daily limits once the operation is signed
+	reservation.Commit()
+	logDecision(key, op, ReasonAllowed, "", "signed")
+	return signed, nil
+}
 
-		fmt.Fprintf(w, response)
+// isCounterSafe ensures manager operations are never signed twice by
+// watermarking the highest counter signed for each source address.  Every
+// counter of a batch must be above the watermark, which advances to the
+// highest.  Operations without a counter, like ballots, are always safe.
+func (server *Server) isCounterSafe(generic *GenericOperation) bool {
+	lowest, highest := generic.Counters()
+	if lowest == nil {
+		return true
 	}
+	return server.watermark.IsRangeSafeToSign(generic.Source(), server.genericChainID, opMagicByteGeneric, lowest, highest)
 }
 
 // shutdown gracefully
@@ -180,7 +457,7 @@ func shutdown(c chan os.Signal) {
 // Serve our routes
 func (server *Server) Serve() {
 	// Handle Sigterm
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go shutdown(c)
 
@@ -188,8 +465,15 @@ func (server *Server) Serve() {
 	http.HandleFunc("/", Middleware(RouteUnmatched))
 	http.HandleFunc("/authorized_keys", Middleware(server.RouteAuthorizedKeys))
 	http.HandleFunc("/keys/", Middleware(server.RouteKeys))
+	http.HandleFunc("/describe", Middleware(server.RouteDescribe))
+	http.HandleFunc("/pending", Middleware(server.RoutePending))
+	http.HandleFunc("/pending/", Middleware(server.RoutePending))
 
 	// Serve
 	log.Println("Listening on:", server.bindString)
+	if server.tls != nil {
+		httpServer := &http.Server{Addr: server.bindString, TLSConfig: server.tls.tlsConfig()}
+		log.Fatal(httpServer.ListenAndServeTLS("", ""))
+	}
 	log.Fatal(http.ListenAndServe(server.bindString, nil))
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -36,7 +37,7 @@ func getTestServer(pkh string) *Server {
 			PublicKeyHash: pkh + "2",
 			PublicKey:     "keyhash2",
 		}},
-		filter: OperationFilter{
+		filter: &OperationFilter{
 			EnableTx: false,
 		},
 		watermark: watermark.GetSessionWatermark(),
@@ -59,8 +60,9 @@ func TestGetEmptyKeys(t *testing.T) {
 		log.Printf("TestGetEmptyKeys: Expected status code 404.  Received %v\n", resp.StatusCode)
 		t.Fail()
 	}
-	if strings.Contains(string(body), "error") {
-		log.Println("TestGetEmptyKeys: requesting in invalid key should return an error")
+	signErr := &SignError{}
+	if err := json.Unmarshal(body, signErr); err != nil || signErr.Code != ReasonKeyNotFound {
+		log.Printf("TestGetEmptyKeys: requesting an invalid key should return a key_not_found error.  Received %s\n", body)
 		t.Fail()
 	}
 }
@@ -103,6 +105,11 @@ func TestRouteUnmatched(t *testing.T) {
 		log.Println("TestRouteUnmatched: Status code should be 404")
 		t.Fail()
 	}
+	signErr := &SignError{}
+	if err := json.NewDecoder(resp.Body).Decode(signErr); err != nil || signErr.Code != ReasonNotFound {
+		log.Println("TestRouteUnmatched: Expected a not_found error body")
+		t.Fail()
+	}
 }
 
 func TestAuthorizedKeys(t *testing.T) {
@@ -206,6 +213,65 @@ func TestPostTxLimit(t *testing.T) {
 	compare(t, "Secp256k1 Over  Amount", resp.StatusCode, http.StatusForbidden, body, testSecp256k1Tx.SignerResponse)
 }
 
+func TestPostTxLimitAfterSigning(t *testing.T) {
+	server := getTestServer("tz123")
+	server.filter.EnableTx = true
+	server.filter.TxDailyMax = new(big.Int).SetInt64(1500000)
+
+	// Transfers that fail to sign don't count towards the limit
+	unsigned := testSecp256k1Tx
+	unsigned.PublicKeyHash = "tz9unknown"
+	resp, body := testPost(t, server, unsigned)
+	compare(t, "Unsigned Tx", resp.StatusCode, http.StatusInternalServerError, body, unsigned.SignerResponse)
+
+	resp, body = testPost(t, server, testP256Tx)
+	compare(t, "p256 Tx After Unsigned Tx", resp.StatusCode, http.StatusOK, body, testP256Tx.SignerResponse)
+}
+
+func testReasonCode(t *testing.T, name string, body string, code string, rule string) {
+	signErr := &SignError{}
+	if err := json.Unmarshal([]byte(body), signErr); err != nil {
+		log.Printf("%v: Unable to decode the error body %v: %v\n", name, body, err)
+		t.Fail()
+		return
+	}
+	if signErr.Code != code || signErr.Rule != rule || len(signErr.Message) == 0 {
+		log.Printf("%v: Expected code %v and rule %q.  Received %v\n", name, code, rule, body)
+		t.Fail()
+	}
+}
+
+func TestPostReasonCodes(t *testing.T) {
+	server := getTestServer("tz123")
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	compare(t, "Filtered", resp.StatusCode, http.StatusForbidden, body, "")
+	testReasonCode(t, "Filtered", body, ReasonFiltered, "enable-tx")
+
+	server.filter.EnableTx = true
+	server.filter.TxDailyMax = new(big.Int).SetInt64(1500000)
+	testPost(t, server, testSecp256k1Tx)
+	resp, body = testPost(t, server, testP256Tx)
+	compare(t, "Limit Exceeded", resp.StatusCode, http.StatusForbidden, body, "")
+	testReasonCode(t, "Limit Exceeded", body, ReasonLimitExceeded, "tx-daily-max")
+
+	testPost(t, server, testEndorseLevel259938)
+	resp, body = testPost(t, server, testEndorseLevel259938)
+	compare(t, "Watermark", resp.StatusCode, http.StatusForbidden, body, "")
+	testReasonCode(t, "Watermark", body, ReasonWatermark, "")
+
+	unparsable := testEndorseLevel259938
+	unparsable.Operation = "\"zz\""
+	resp, body = testPost(t, server, unparsable)
+	compare(t, "Parse Error", resp.StatusCode, http.StatusBadRequest, body, "")
+	testReasonCode(t, "Parse Error", body, ReasonParseError, "")
+
+	unsigned := testEndorseLevel259939
+	unsigned.PublicKeyHash = "tz9unknown"
+	resp, body = testPost(t, server, unsigned)
+	compare(t, "Backend Error", resp.StatusCode, http.StatusInternalServerError, body, "")
+	testReasonCode(t, "Backend Error", body, ReasonBackendError, "")
+}
+
 func TestPostEndorse(t *testing.T) {
 	server := getTestServer("tz123")
 	// Endorsing at the same level twice should fail
@@ -228,3 +294,107 @@ func TestPostEndorse(t *testing.T) {
 	resp, body = testPost(t, server, testEndorseLevel259939)
 	compare(t, "Secp256k1 Endorse Lower Level #2", resp.StatusCode, http.StatusOK, body, testEndorseLevel259939.SignerResponse)
 }
+
+func TestPostTxCounter(t *testing.T) {
+	server := getTestServer("tz123")
+	server.filter.EnableTx = true
+
+	// Signing the same transaction twice should fail
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	compare(t, "Secp256k1 Tx Counter #1", resp.StatusCode, http.StatusOK, body, testSecp256k1Tx.SignerResponse)
+	resp, body = testPost(t, server, testSecp256k1Tx)
+	compare(t, "Secp256k1 Tx Counter #2", resp.StatusCode, http.StatusForbidden, body, testSecp256k1Tx.SignerResponse)
+
+	// Counters are tracked per source
+	resp, body = testPost(t, server, testP256Tx)
+	compare(t, "P256 Tx Counter", resp.StatusCode, http.StatusOK, body, testP256Tx.SignerResponse)
+
+	// And per chain
+	server.SetGenericChainID("NetXdQprcVkpaWU")
+	resp, body = testPost(t, server, testSecp256k1Tx)
+	compare(t, "Secp256k1 Tx Counter Other Chain", resp.StatusCode, http.StatusOK, body, testSecp256k1Tx.SignerResponse)
+}
+
+func TestBatchCounter(t *testing.T) {
+	server := getTestServer("tz123")
+	op, _ := ParseOperation([]byte(testBatch))
+	batch := GetGenericOperation(op)
+
+	// A batch of counters 2 to 4 can't replay counter 3
+	server.watermark.IsSafeToSign(batch.Source(), "", opMagicByteGeneric, big.NewInt(3))
+	if server.isCounterSafe(batch) {
+		log.Println("[Batch Counter Test] A batch including a signed counter should fail")
+		t.Fail()
+	}
+	server.SetGenericChainID("NetXdQprcVkpaWU")
+	if !server.isCounterSafe(batch) || server.watermark.IsSafeToSign(batch.Source(), "NetXdQprcVkpaWU", opMagicByteGeneric, big.NewInt(4)) {
+		log.Println("[Batch Counter Test] A batch should be watermarked at its highest counter")
+		t.Fail()
+	}
+}
+
+// testDescription holds the fields of a Description that can be unmarshaled
+type testDescription struct {
+	MagicByte string            `json:"magic_byte"`
+	ChainID   string            `json:"chain_id"`
+	Level     *big.Int          `json:"level"`
+	Allowed   bool              `json:"allowed"`
+	Decisions []*FilterDecision `json:"decisions"`
+}
+
+func testDescribe(t *testing.T, server *Server, operation string) (*http.Response, *testDescription) {
+	return testDescribePath(t, server, "/describe", operation)
+}
+
+func testDescribePath(t *testing.T, server *Server, path string, operation string) (*http.Response, *testDescription) {
+	r := httptest.NewRequest("POST", path, strings.NewReader(operation))
+	w := httptest.NewRecorder()
+	Middleware(server.RouteDescribe)(w, r)
+	resp := w.Result()
+
+	description := &testDescription{}
+	if resp.StatusCode == http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(body, description); err != nil {
+			log.Println("Unable to unmarshal description:", err)
+			t.Fail()
+		}
+	}
+	return resp, description
+}
+
+func TestDescribe(t *testing.T) {
+	server := getTestServer("tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m")
+	server.filter.EnableTx = true
+	server.filter.TxDailyMax = new(big.Int).SetInt64(1500000)
+
+	resp, description := testDescribe(t, server, testEndorse.Operation)
+	if resp.StatusCode != http.StatusOK || description.MagicByte != "0x02" || description.ChainID != testEndorse.ChainID || description.Level.String() != testEndorse.Level {
+		log.Printf("Describe Endorsement: Unexpected description %+v\n", description)
+		t.Fail()
+	}
+
+	// Describing a transfer never counts towards the daily limit
+	for i := 0; i < 2; i++ {
+		resp, description = testDescribe(t, server, testSecp256k1Tx.Operation)
+		if resp.StatusCode != http.StatusOK || !description.Allowed || len(description.Decisions) != 3 {
+			log.Printf("Describe Tx #%v: Unexpected description %+v\n", i, description)
+			t.Fail()
+		}
+	}
+	resp, body := testPost(t, server, testSecp256k1Tx)
+	compare(t, "Secp256k1 Tx After Describe", resp.StatusCode, http.StatusOK, body, testSecp256k1Tx.SignerResponse)
+
+	server.filter.EnableTx = false
+	_, description = testDescribe(t, server, testSecp256k1Tx.Operation)
+	if description.Allowed || description.Decisions[0].Rule != "enable-tx" || description.Decisions[0].Allowed {
+		log.Printf("Describe Disabled Tx: Unexpected description %+v\n", description)
+		t.Fail()
+	}
+
+	resp, _ = testDescribe(t, server, "\"09\"")
+	if resp.StatusCode != http.StatusBadRequest {
+		log.Println("Describe Unknown Magic Byte: Expected status code 400, received", resp.StatusCode)
+		t.Fail()
+	}
+}
@@ -0,0 +1,278 @@
+package signer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Tags of octez signer-messages requests, sent over tcp:// and unix://
+// remote signer sockets
+const (
+	socketRequestSign                        = 0x00
+	socketRequestPublicKey                   = 0x01
+	socketRequestAuthorizedKeys              = 0x02
+	socketRequestDeterministicNonce          = 0x03
+	socketRequestDeterministicNonceHash      = 0x04
+	socketRequestSupportsDeterministicNonces = 0x05
+	socketRequestKnownKeys                   = 0x06
+)
+
+const (
+	// Tags of results
+	socketResultOk    = 0x00
+	socketResultError = 0x01
+
+	// Tags of the Authorized_keys response
+	socketNoAuthentication = 0x00
+	socketAuthorizedKeys   = 0x01
+
+	// Size of binary public key hashes and signatures
+	socketPkhLength       = 21
+	socketSignatureLength = 64
+
+	// Messages are framed by their 2 byte length
+	socketMaxMessageLength = 1<<16 - 1
+
+	// Time for TLS clients to complete the handshake
+	socketHandshakeTimeout = 10 * time.Second
+)
+
+// ListenSocket serves the octez binary signer protocol on the network, "tcp"
+// or "unix", in the background.  TCP sockets are served over TLS, with the
+// same client certificates, if it's set.  Unix sockets rely on the file's
+// permissions.
+func (server *Server) ListenSocket(network string, address string) {
+	if network == "unix" {
+		// Remove the socket left by a previous run
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatalf("Unable to listen on %v://%v: %v\n", network, address, err)
+	}
+	if network == "tcp" && server.tls != nil {
+		listener = tls.NewListener(listener, server.tls.tlsConfig())
+	}
+	log.Printf("Listening on: %v://%v\n", network, address)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Println("[ERROR] Socket listener stopped:", err)
+				return
+			}
+			go server.serveSocket(conn)
+		}
+	}()
+}
+
+// serveSocket answers each request of the connection until it's closed
+func (server *Server) serveSocket(conn net.Conn) {
+	defer conn.Close()
+	var state *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(socketHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Println("[WARN] Socket TLS handshake failed:", err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+		connectionState := tlsConn.ConnectionState()
+		state = &connectionState
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readSocketMessage(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Println("[WARN] Error reading socket request:", err)
+			}
+			return
+		}
+		response := server.socketResponse(request, state)
+		if err := writeSocketMessage(conn, response); err != nil {
+			log.Println("[WARN] Error writing socket response:", err)
+			return
+		}
+	}
+}
+
+// readSocketMessage framed by its 2 byte big endian length
+func readSocketMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// writeSocketMessage framed by its 2 byte big endian length
+func writeSocketMessage(writer io.Writer, message []byte) error {
+	if len(message) > socketMaxMessageLength {
+		return fmt.Errorf("message of %v bytes is too long", len(message))
+	}
+	framed := make([]byte, 2, 2+len(message))
+	binary.BigEndian.PutUint16(framed, uint16(len(message)))
+	_, err := writer.Write(append(framed, message...))
+	return err
+}
+
+// socketResponse to the request, an ok or error result.  The state of TLS
+// connections limits the keys the client may use.
+func (server *Server) socketResponse(request []byte, state *tls.ConnectionState) []byte {
+	if len(request) == 0 {
+		return socketError(signError(0, ReasonParseError, "empty request"))
+	}
+	body := request[1:]
+	switch request[0] {
+	case socketRequestSign:
+		return server.socketSign(body, state)
+	case socketRequestPublicKey:
+		key, signErr := server.socketKey(body, state)
+		if signErr != nil {
+			return socketError(signErr)
+		}
+		publicKey, err := publicKeyBytes(key.PublicKey)
+		if err != nil {
+			return socketError(signError(0, ReasonBackendError, err.Error()))
+		}
+		return append([]byte{socketResultOk}, publicKey...)
+	case socketRequestAuthorizedKeys:
+		if server.authorizedKeys == nil {
+			return []byte{socketResultOk, socketNoAuthentication}
+		}
+		response := []byte{socketResultOk, socketAuthorizedKeys}
+		for _, authorized := range server.authorizedKeys {
+			pkh, _ := hex.DecodeString(PubkeyHashToByteString(authorized.publicKeyHash))
+			response = append(response, pkh...)
+		}
+		return response
+	case socketRequestSupportsDeterministicNonces:
+		if _, signErr := server.socketKey(body, state); signErr != nil {
+			return socketError(signErr)
+		}
+		return []byte{socketResultOk, 0x00}
+	case socketRequestDeterministicNonce, socketRequestDeterministicNonceHash:
+		// HSM keys can't derive nonces, which clients check for first
+		return socketError(signError(0, ReasonBadRequest, "deterministic nonces aren't supported"))
+	case socketRequestKnownKeys:
+		response := []byte{socketResultOk}
+		subject, _ := server.connectionSubject(state)
+		for _, key := range server.keys {
+			if state != nil && subject != nil && !subject.allows(&key) {
+				continue
+			}
+			pkh, _ := hex.DecodeString(PubkeyHashToByteString(key.PublicKeyHash))
+			response = append(response, pkh...)
+		}
+		return response
+	}
+	return socketError(signError(0, ReasonBadRequest, fmt.Sprintf("unknown request tag %v", request[0])))
+}
+
+// socketSign decodes a sign request: the key's public key hash, the
+// length prefixed data and an optional authentication signature
+func (server *Server) socketSign(body []byte, state *tls.ConnectionState) []byte {
+	if len(body) < socketPkhLength {
+		return socketError(signError(0, ReasonParseError, "malformed sign request"))
+	}
+	key, signErr := server.socketKey(body[:socketPkhLength], state)
+	if signErr != nil {
+		return socketError(signErr)
+	}
+	body = body[socketPkhLength:]
+	if len(body) < 4 || uint32(len(body)-4) < binary.BigEndian.Uint32(body) {
+		return socketError(signError(0, ReasonParseError, "malformed sign request"))
+	}
+	dataLength := binary.BigEndian.Uint32(body)
+	data, body := body[4:4+dataLength], body[4+dataLength:]
+
+	authentication := ""
+	if len(body) == 1+socketSignatureLength && body[0] == 0xff {
+		prefix, _ := hex.DecodeString(tzGenericSignature)
+		authentication = b58CheckEncode(prefix, body[1:])
+	} else if len(body) != 1 || body[0] != 0x00 {
+		return socketError(signError(0, ReasonParseError, "malformed sign request"))
+	}
+
+	// Requests are signed like HTTP ones, as quoted hex
+	request := []byte("\"" + hex.EncodeToString(data) + "\"")
+	if signErr := server.authenticate(key, request, authentication); signErr != nil {
+		return socketError(signErr)
+	}
+	signed, signErr := server.sign(context.Background(), key, request, false)
+	if signErr != nil {
+		return socketError(signErr)
+	}
+	prefix, _ := getSignaturePrefix(key)
+	signature, err := b58CheckDecode(signed, hex.EncodeToString(prefix))
+	if err != nil {
+		return socketError(signError(0, ReasonBackendError, err.Error()))
+	}
+	return append([]byte{socketResultOk}, signature...)
+}
+
+// socketKey with the binary public key hash, if the client may use it
+func (server *Server) socketKey(pkhBytes []byte, state *tls.ConnectionState) (*Key, *SignError) {
+	if len(pkhBytes) != socketPkhLength {
+		return nil, signError(0, ReasonParseError, "malformed public key hash")
+	}
+	pkh := ByteStringToPubkeyHash(hex.EncodeToString(pkhBytes))
+	key := server.findKey(pkh)
+	if key == nil {
+		log.Println("Key not found:", pkh)
+		return nil, signError(0, ReasonKeyNotFound, "key not found")
+	}
+	if state != nil {
+		if signErr := server.authorizeConnection(state, key); signErr != nil {
+			return nil, signErr
+		}
+	}
+	return key, nil
+}
+
+// socketError result with the error as a JSON error trace, like octez
+func socketError(signErr *SignError) []byte {
+	trace, _ := json.Marshal(map[string]string{
+		"kind":  "temporary",
+		"id":    "hsm-signer." + signErr.Code,
+		"error": signErr.Error(),
+	})
+	response := []byte{socketResultError, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(response[1:], uint32(len(trace)))
+	return append(response, trace...)
+}
+
+// publicKeyBytes of a b58 encoded public key, tagged with its curve.  Tags
+// follow the order of publicKeyCurves: ed25519, secp256k1 then P-256.
+func publicKeyBytes(publicKey string) ([]byte, error) {
+	for tag, c := range publicKeyCurves {
+		if !strings.HasPrefix(publicKey, c.prefix) {
+			continue
+		}
+		keyBytes, err := b58CheckDecode(publicKey, c.keyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{byte(tag)}, keyBytes...), nil
+	}
+	return nil, errors.New("unsupported public key " + publicKey)
+}
@@ -0,0 +1,189 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSocketRequest sends the request over a new connection, returning the
+// response
+func testSocketRequest(t *testing.T, address string, request []byte) []byte {
+	conn, err := net.Dial("unix", address)
+	if err != nil {
+		log.Println("[Socket Test] Unable to connect:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+	writeSocketMessage(conn, request)
+	response, err := readSocketMessage(conn)
+	if err != nil {
+		log.Println("[Socket Test] Unable to read the response:", err)
+		t.FailNow()
+	}
+	return response
+}
+
+// testSocketSign request for the transfer, with the authentication if any
+func testSocketSign(authentication []byte) []byte {
+	pkh, _ := hex.DecodeString(PubkeyHashToByteString(testSecp256k1Tx.PublicKeyHash))
+	data, _ := hex.DecodeString(strings.Trim(testSecp256k1Tx.Operation, "\""))
+	request := append([]byte{socketRequestSign}, pkh...)
+	request = append(request, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(request[len(request)-4:], uint32(len(data)))
+	request = append(request, data...)
+	if authentication == nil {
+		return append(request, 0x00)
+	}
+	return append(append(request, 0xff), authentication...)
+}
+
+func TestSocketSigner(t *testing.T) {
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.filter.EnableTx = true
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	server.signer = &testSigner{SignedBytes: signedBytes}
+	publicKey, _ := testKeyPair(t, curveSecp256k1)
+	server.keys[0].PublicKey = publicKey
+
+	address := t.TempDir() + "/signer.sock"
+	server.ListenSocket("unix", address)
+	pkh, _ := hex.DecodeString(PubkeyHashToByteString(testSecp256k1Tx.PublicKeyHash))
+
+	expected, _ := publicKeyBytes(publicKey)
+	if response := testSocketRequest(t, address, append([]byte{socketRequestPublicKey}, pkh...)); !bytes.Equal(response, append([]byte{socketResultOk}, expected...)) || response[1] != 0x01 {
+		log.Printf("[Socket Test] Expected the tagged secp256k1 public key.  Received %x\n", response)
+		t.Fail()
+	}
+	if response := testSocketRequest(t, address, []byte{socketRequestAuthorizedKeys}); !bytes.Equal(response, []byte{socketResultOk, socketNoAuthentication}) {
+		log.Printf("[Socket Test] Expected no authentication.  Received %x\n", response)
+		t.Fail()
+	}
+	if response := testSocketRequest(t, address, append([]byte{socketRequestSupportsDeterministicNonces}, pkh...)); !bytes.Equal(response, []byte{socketResultOk, 0x00}) {
+		log.Printf("[Socket Test] Expected deterministic nonces to be unsupported.  Received %x\n", response)
+		t.Fail()
+	}
+	if response := testSocketRequest(t, address, []byte{0x42}); response[0] != socketResultError {
+		log.Printf("[Socket Test] Expected an unknown request to fail.  Received %x\n", response)
+		t.Fail()
+	}
+
+	signature, _ := b58CheckDecode(strings.Split(testSecp256k1Tx.SignerResponse, "\"")[3], tzSecp256k1Signature)
+	if response := testSocketRequest(t, address, testSocketSign(nil)); !bytes.Equal(response, append([]byte{socketResultOk}, signature...)) {
+		log.Printf("[Socket Test] Expected the transfer to be signed.  Received %x\n", response)
+		t.Fail()
+	}
+	server.filter.EnableTx = false
+	if response := testSocketRequest(t, address, testSocketSign(nil)); response[0] != socketResultError || !bytes.Contains(response, []byte(ReasonFiltered)) {
+		log.Printf("[Socket Test] Expected a filtered transfer to fail.  Received %s\n", response)
+		t.Fail()
+	}
+}
+
+func TestSocketAuthentication(t *testing.T) {
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.filter.EnableTx = true
+	signedBytes, _ := hex.DecodeString(testSecp256k1Tx.HsmResponse)
+	server.signer = &testSigner{SignedBytes: signedBytes}
+
+	authorized, sign := testKeyPair(t, curveEd25519)
+	authorizedHash, _ := PublicKeyHash(authorized)
+	server.RequireAuthentication([]*AuthorizedKey{&AuthorizedKey{Name: "baker", PublicKey: authorized, publicKeyHash: authorizedHash}})
+
+	address := t.TempDir() + "/signer.sock"
+	server.ListenSocket("unix", address)
+
+	authorizedBytes, _ := hex.DecodeString(PubkeyHashToByteString(authorizedHash))
+	if response := testSocketRequest(t, address, []byte{socketRequestAuthorizedKeys}); !bytes.Equal(response, append([]byte{socketResultOk, socketAuthorizedKeys}, authorizedBytes...)) {
+		log.Printf("[Socket Test] Expected the authorized key hash.  Received %x\n", response)
+		t.Fail()
+	}
+	if response := testSocketRequest(t, address, testSocketSign(nil)); response[0] != socketResultError || !bytes.Contains(response, []byte(ReasonUnauthorized)) {
+		log.Printf("[Socket Test] Expected an unauthenticated request to fail.  Received %s\n", response)
+		t.Fail()
+	}
+
+	data, _ := hex.DecodeString(strings.Trim(testSecp256k1Tx.Operation, "\""))
+	message, _ := authenticationMessage(&server.keys[0], data)
+	authentication, _ := b58CheckDecode(sign(message), tzEd25519Signature)
+	if response := testSocketRequest(t, address, testSocketSign(authentication)); response[0] != socketResultOk || len(response) != 1+socketSignatureLength {
+		log.Printf("[Socket Test] Expected an authenticated request to be signed.  Received %s\n", response)
+		t.Fail()
+	}
+}
+
+func TestSocketTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caPEM, _ := testCert(t, "ca", 1, nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "signer", 2, ca, caKey)
+	_, _, bakerPEM, bakerKeyPEM := testCert(t, "baker", 3, ca, caKey)
+	ioutil.WriteFile(dir+"/ca.pem", caPEM, 0600)
+	ioutil.WriteFile(dir+"/cert.pem", serverPEM, 0600)
+	ioutil.WriteFile(dir+"/key.pem", serverKeyPEM, 0600)
+
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.keys = append(server.keys, Key{Name: "other", PublicKeyHash: "tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"})
+	server.SetTLS(&TLSConfig{
+		CertFile:       dir + "/cert.pem",
+		KeyFile:        dir + "/key.pem",
+		ClientCAFile:   dir + "/ca.pem",
+		ClientSubjects: []*ClientSubject{&ClientSubject{Subject: "baker", Keys: []string{"test"}}},
+	})
+	free, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := free.Addr().String()
+	free.Close()
+	server.ListenSocket("tcp", address)
+
+	// Plaintext clients can't use the socket
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		writeSocketMessage(conn, []byte{socketRequestKnownKeys})
+		if response, err := readSocketMessage(conn); err == nil {
+			log.Printf("[Socket Test] Expected a plaintext request to fail.  Received %x\n", response)
+			t.Fail()
+		}
+		conn.Close()
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	cert, _ := tls.X509KeyPair(bakerPEM, bakerKeyPEM)
+	conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		log.Println("[Socket Test] Unable to connect over TLS:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+	request := func(message []byte) []byte {
+		writeSocketMessage(conn, message)
+		response, err := readSocketMessage(conn)
+		if err != nil {
+			log.Println("[Socket Test] Unable to read the response:", err)
+			t.FailNow()
+		}
+		return response
+	}
+
+	pkh, _ := hex.DecodeString(PubkeyHashToByteString(testSecp256k1Tx.PublicKeyHash))
+	if response := request([]byte{socketRequestKnownKeys}); !bytes.Equal(response, append([]byte{socketResultOk}, pkh...)) {
+		log.Printf("[Socket Test] Expected only the baker's key to be known.  Received %x\n", response)
+		t.Fail()
+	}
+	other, _ := hex.DecodeString(PubkeyHashToByteString("tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"))
+	if response := request(append([]byte{socketRequestSupportsDeterministicNonces}, other...)); response[0] != socketResultError || !bytes.Contains(response, []byte(ReasonUnauthorized)) {
+		log.Printf("[Socket Test] Expected the baker to be refused another key.  Received %s\n", response)
+		t.Fail()
+	}
+	if response := request(append([]byte{socketRequestSupportsDeterministicNonces}, pkh...)); !bytes.Equal(response, []byte{socketResultOk, 0x00}) {
+		log.Printf("[Socket Test] Expected the baker to use its key.  Received %x\n", response)
+		t.Fail()
+	}
+}
@@ -0,0 +1,208 @@
+package signer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TLSConfig of the signing listener.  Clients must present a certificate
+// signed by the ClientCAFile, if set, whose subject is in ClientSubjects.
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientSubjects []*ClientSubject
+
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTime  time.Time
+}
+
+// ClientSubject of a client certificate and the keys the client may use
+type ClientSubject struct {
+	// Common name or full distinguished name, e.g. CN=baker,O=Example
+	Subject string `yaml:"Subject"`
+	// Names or public key hashes of the keys
+	Keys []string `yaml:"Keys"`
+}
+
+// LoadClientSubjectsFile loads the client certificate subjects allowed to
+// connect and the keys each may use
+func LoadClientSubjectsFile(file string) []*ClientSubject {
+	subjects := []*ClientSubject{}
+
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln("Unable to read file: " + file)
+	}
+	err = yaml.Unmarshal(yamlFile, &subjects)
+	if err != nil {
+		log.Fatalln("Unable to parse yaml file: " + file)
+	}
+	for _, subject := range subjects {
+		if len(subject.Subject) == 0 {
+			log.Fatalln("Client subjects need a Subject: " + file)
+		}
+	}
+	return subjects
+}
+
+// SetTLS serves over TLS with the config, loading its files now so errors
+// are fatal at startup
+func (server *Server) SetTLS(config *TLSConfig) {
+	if len(config.ClientSubjects) > 0 && len(config.ClientCAFile) == 0 {
+		log.Fatalln("Client subjects need a client CA to verify certificates")
+	}
+	if err := config.reload(); err != nil {
+		log.Fatal(err)
+	}
+	server.tls = config
+}
+
+// reload the certificate and client CA if any of their files changed
+func (config *TLSConfig) reload() error {
+	modTime := time.Time{}
+	for _, file := range []string{config.CertFile, config.KeyFile, config.ClientCAFile} {
+		if len(file) == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	config.mutex.Lock()
+	defer config.mutex.Unlock()
+	if config.cert != nil && !modTime.After(config.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate: %v", err)
+	}
+	var clientCA *x509.CertPool
+	if len(config.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %v", config.ClientCAFile)
+		}
+	}
+	if config.cert != nil {
+		log.Println("[INFO] Reloaded TLS certificates")
+	}
+	config.cert, config.clientCA, config.modTime = &cert, clientCA, modTime
+	return nil
+}
+
+// tlsConfig for each handshake, reloading changed certificates.  If a reload
+// fails the previous certificates are kept.
+func (config *TLSConfig) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			if err := config.reload(); err != nil {
+				log.Println("[ERROR] Unable to reload TLS certificates:", err)
+			}
+			config.mutex.Lock()
+			defer config.mutex.Unlock()
+			handshake := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*config.cert},
+			}
+			if config.clientCA != nil {
+				handshake.ClientAuth = tls.RequireAndVerifyClientCert
+				handshake.ClientCAs = config.clientCA
+				handshake.VerifyConnection = config.verifyConnection
+			}
+			return handshake, nil
+		},
+	}
+}
+
+// verifyConnection refuses clients whose subject isn't allowed
+func (config *TLSConfig) verifyConnection(state tls.ConnectionState) error {
+	if len(config.ClientSubjects) == 0 {
+		return nil
+	}
+	if config.clientSubject(state.PeerCertificates) == nil {
+		return fmt.Errorf("client certificate subject %v isn't allowed", state.PeerCertificates[0].Subject)
+	}
+	return nil
+}
+
+// clientSubject matching the verified client certificate, or nil
+func (config *TLSConfig) clientSubject(certs []*x509.Certificate) *ClientSubject {
+	if len(certs) == 0 {
+		return nil
+	}
+	for _, subject := range config.ClientSubjects {
+		if subject.Subject == certs[0].Subject.CommonName || subject.Subject == certs[0].Subject.String() {
+			return subject
+		}
+	}
+	return nil
+}
+
+// authorizeClient to use the key, if client subjects are configured
+func (server *Server) authorizeClient(r *http.Request, key *Key) *SignError {
+	return server.authorizeConnection(r.TLS, key)
+}
+
+// authorizeConnection of the client to use the key, if client subjects are
+// configured.  The state is nil for plaintext connections.
+func (server *Server) authorizeConnection(state *tls.ConnectionState, key *Key) *SignError {
+	subject, signErr := server.connectionSubject(state)
+	if subject == nil {
+		return signErr
+	}
+	if subject.allows(key) {
+		return nil
+	}
+	log.Printf("[WARN] Client %v isn't allowed to use key %v\n", subject.Subject, key.PublicKeyHash)
+	return signError(http.StatusForbidden, ReasonUnauthorized, "client isn't allowed to use "+key.PublicKeyHash)
+}
+
+// connectionSubject of the client certificate.  Returns nil without an
+// error if client subjects aren't configured.
+func (server *Server) connectionSubject(state *tls.ConnectionState) (*ClientSubject, *SignError) {
+	if server.tls == nil || len(server.tls.ClientSubjects) == 0 {
+		return nil, nil
+	}
+	if state == nil {
+		return nil, signError(http.StatusForbidden, ReasonUnauthorized, "client certificate required")
+	}
+	subject := server.tls.clientSubject(state.PeerCertificates)
+	if subject == nil {
+		return nil, signError(http.StatusForbidden, ReasonUnauthorized, "client certificate subject isn't allowed")
+	}
+	return subject, nil
+}
+
+// allows the client to use the key, by name or public key hash?
+func (subject *ClientSubject) allows(key *Key) bool {
+	for _, allowed := range subject.Keys {
+		if allowed == key.Name || allowed == key.PublicKeyHash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testCert signed by the parent, or self signed if the parent is nil,
+// returning the certificate and its PEM encoded certificate and key
+func testCert(t *testing.T, name string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		log.Println("[TLS Test] Unable to create a certificate:", err)
+		t.FailNow()
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// testClient presenting the certificate, if any, and trusting the CA
+func testClient(ca *x509.Certificate, certPEM []byte, keyPEM []byte) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	config := &tls.Config{RootCAs: roots}
+	if certPEM != nil {
+		cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caPEM, _ := testCert(t, "ca", 1, nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "signer", 2, ca, caKey)
+	_, _, bakerPEM, bakerKeyPEM := testCert(t, "baker", 3, ca, caKey)
+	_, _, strangerPEM, strangerKeyPEM := testCert(t, "stranger", 4, ca, caKey)
+	ioutil.WriteFile(dir+"/ca.pem", caPEM, 0600)
+	ioutil.WriteFile(dir+"/cert.pem", serverPEM, 0600)
+	ioutil.WriteFile(dir+"/key.pem", serverKeyPEM, 0600)
+
+	server := getTestServer(testSecp256k1Tx.PublicKeyHash)
+	server.SetTLS(&TLSConfig{
+		CertFile:       dir + "/cert.pem",
+		KeyFile:        dir + "/key.pem",
+		ClientCAFile:   dir + "/ca.pem",
+		ClientSubjects: []*ClientSubject{&ClientSubject{Subject: "CN=baker", Keys: []string{"test"}}},
+	})
+	listener := httptest.NewUnstartedServer(Middleware(server.RouteKeys))
+	listener.TLS = server.tls.tlsConfig()
+	listener.StartTLS()
+	defer listener.Close()
+
+	get := func(client *http.Client, pkh string) (int, error) {
+		resp, err := client.Get(listener.URL + "/keys/" + pkh)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	baker := testClient(ca, bakerPEM, bakerKeyPEM)
+	if status, err := get(baker, testSecp256k1Tx.PublicKeyHash); status != http.StatusOK {
+		log.Printf("[TLS Test] Expected the baker to use its key.  Received %v: %v\n", status, err)
+		t.Fail()
+	}
+	if status, err := get(baker, testSecp256k1Tx.PublicKeyHash+"2"); status != http.StatusForbidden {
+		log.Printf("[TLS Test] Expected the baker to be refused another key.  Received %v: %v\n", status, err)
+		t.Fail()
+	}
+	if _, err := get(testClient(ca, strangerPEM, strangerKeyPEM), testSecp256k1Tx.PublicKeyHash); err == nil {
+		log.Println("[TLS Test] Expected a client with another subject to be refused")
+		t.Fail()
+	}
+	if _, err := get(testClient(ca, nil, nil), testSecp256k1Tx.PublicKeyHash); err == nil {
+		log.Println("[TLS Test] Expected a client without a certificate to be refused")
+		t.Fail()
+	}
+
+	// A renewed certificate is served without a restart
+	_, _, renewedPEM, renewedKeyPEM := testCert(t, "signer", 5, ca, caKey)
+	ioutil.WriteFile(dir+"/cert.pem", renewedPEM, 0600)
+	ioutil.WriteFile(dir+"/key.pem", renewedKeyPEM, 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(dir+"/cert.pem", later, later)
+	resp, err := baker.Get(listener.URL + "/keys/" + testSecp256k1Tx.PublicKeyHash)
+	if err != nil || resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 5 {
+		log.Printf("[TLS Test] Expected the renewed certificate to be served: %v\n", err)
+		t.Fail()
+	}
+}
+
+func TestClientSubjectPending(t *testing.T) {
+	server, _ := testApprovalServer(t)
+	id := testHold(t, server)
+	ca, caKey, _, _ := testCert(t, "ca", 1, nil, nil)
+	baker, _, _, _ := testCert(t, "baker", 2, ca, caKey)
+	stranger, _, _, _ := testCert(t, "stranger", 3, ca, caKey)
+	server.tls = &TLSConfig{ClientSubjects: []*ClientSubject{
+		&ClientSubject{Subject: "baker", Keys: []string{testSecp256k1Tx.PublicKeyHash}},
+		&ClientSubject{Subject: "stranger", Keys: []string{"other"}},
+	}}
+
+	request := func(cert *x509.Certificate, path string, v interface{}) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		w := httptest.NewRecorder()
+		Middleware(server.RoutePending)(w, r)
+		json.NewDecoder(w.Result().Body).Decode(v)
+		return w.Result().StatusCode
+	}
+
+	listed := []*PendingRequest{}
+	if status := request(baker, "/pending", &listed); status != http.StatusOK || len(listed) != 1 || listed[0].ID != id {
+		log.Printf("[TLS Test] Expected the baker to list its request.  Received %v %v\n", status, listed)
+		t.Fail()
+	}
+	listed = []*PendingRequest{}
+	if status := request(stranger, "/pending", &listed); status != http.StatusOK || len(listed) != 0 {
+		log.Printf("[TLS Test] Expected the stranger's list to be empty.  Received %v %v\n", status, listed)
+		t.Fail()
+	}
+	if status := request(stranger, "/pending/"+id, &PendingRequest{}); status != http.StatusForbidden {
+		log.Printf("[TLS Test] Expected the stranger to be refused the request.  Received %v\n", status)
+		t.Fail()
+	}
+	if status := request(baker, "/pending/"+id, &PendingRequest{}); status != http.StatusOK {
+		log.Printf("[TLS Test] Expected the baker to poll its request.  Received %v\n", status)
+		t.Fail()
+	}
+	if status := testPending(server, "GET", "/pending/"+id, "", &PendingRequest{}); status != http.StatusForbidden {
+		log.Printf("[TLS Test] Expected a request without a certificate to be refused.  Received %v\n", status)
+		t.Fail()
+	}
+}
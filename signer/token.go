@@ -0,0 +1,291 @@
+package signer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TokenPolicy allows FA1.2 and FA2 calls to a token contract, restricting
+// recipients and the amount moved per day in the token's smallest unit.
+// Operators can spend without limit, so with a DailyMax only those listed in
+// Operators may be added.
+type TokenPolicy struct {
+	Name               string   `yaml:"Name"`
+	Contract           string   `yaml:"Contract"`
+	TokenID            string   `yaml:"TokenID"`
+	WhitelistAddresses []string `yaml:"WhitelistAddresses"`
+	DailyMax           string   `yaml:"DailyMax"`
+	Operators          []string `yaml:"Operators"`
+
+	dailyMax *big.Int
+}
+
+// tokenTransfer is a single movement of tokens decoded from a contract call.
+// Approvals and operator updates are transfers of the allowance to the spender.
+type tokenTransfer struct {
+	TokenID  *big.Int
+	To       string
+	Amount   *big.Int
+	Operator bool
+}
+
+// LoadTokenPolicyFile loads token policies from a file
+func LoadTokenPolicyFile(file string) []*TokenPolicy {
+	policies := []*TokenPolicy{}
+
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln("Unable to read file: " + file)
+	}
+	err = yaml.Unmarshal(yamlFile, &policies)
+	if err != nil {
+		log.Fatalln("Unable to parse yaml file: " + file)
+	}
+	for _, policy := range policies {
+		if len(policy.DailyMax) > 0 {
+			var ok bool
+			policy.dailyMax, ok = new(big.Int).SetString(policy.DailyMax, 10)
+			if !ok {
+				log.Fatalf("Invalid DailyMax for token %v: %v\n", policy.Name, policy.DailyMax)
+			}
+		}
+	}
+	return policies
+}
+
+// isTokenCall to a contract with a token policy?
+func (filter *OperationFilter) isTokenCall(tx *Transaction) bool {
+	for _, policy := range filter.TokenPolicies {
+		if policy.Contract == tx.Destination {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateTokenCall allows the call if every transfer it makes is allowed by
+// a policy of the contract, adding the amounts to tokenValues to be
+// authorized for the batch
+func (filter *OperationFilter) evaluateTokenCall(subject string, tx *Transaction, tokenValues map[*TokenPolicy]*big.Int) []*FilterDecision {
+	if tx.Amount.Sign() != 0 {
+		return []*FilterDecision{deny("token-policy-file", subject, "token calls may not transfer tez")}
+	}
+	transfers, err := tokenTransfers(tx)
+	if err != nil {
+		return []*FilterDecision{denyWith(ReasonParseError, "token-policy-file", subject, "unable to decode token call: "+err.Error())}
+	}
+
+	decisions := []*FilterDecision{}
+	for _, transfer := range transfers {
+		policy := filter.tokenPolicy(tx.Destination, transfer.TokenID)
+		if policy == nil {
+			reason := fmt.Sprintf("no policy for token %v of %v", transfer.TokenID, tx.Destination)
+			decisions = append(decisions, deny("token-policy-file", subject, reason))
+			continue
+		}
+		if !policy.isWhitelisted(transfer.To) {
+			reason := fmt.Sprintf("%v recipient %v is not whitelisted", policy.Name, transfer.To)
+			decisions = append(decisions, deny("token-policy-file", subject, reason))
+			continue
+		}
+		if transfer.Operator && policy.dailyMax != nil && !policy.isOperator(transfer.To) {
+			reason := fmt.Sprintf("%v operator %v would bypass the daily max", policy.Name, transfer.To)
+			decisions = append(decisions, deny("token-policy-file", subject, reason))
+			continue
+		}
+		reason := fmt.Sprintf("%v transfer of %v to %v", policy.Name, transfer.Amount, transfer.To)
+		decisions = append(decisions, allow("token-policy-file", subject, reason))
+		if tokenValues[policy] == nil {
+			tokenValues[policy] = new(big.Int)
+		}
+		tokenValues[policy].Add(tokenValues[policy], transfer.Amount)
+	}
+	return decisions
+}
+
+// tokenPolicy of a contract that applies to the token ID
+func (filter *OperationFilter) tokenPolicy(contract string, tokenID *big.Int) *TokenPolicy {
+	for _, policy := range filter.TokenPolicies {
+		if policy.Contract != contract {
+			continue
+		}
+		if len(policy.TokenID) == 0 || (tokenID != nil && policy.TokenID == tokenID.String()) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// Is this address whitelisted? Returns true if whitelistising is disabled
+func (policy *TokenPolicy) isWhitelisted(address string) bool {
+	if policy.WhitelistAddresses == nil {
+		return true
+	}
+	for _, pkh := range policy.WhitelistAddresses {
+		if pkh == address {
+			return true
+		}
+	}
+	return false
+}
+
+// isOperator allowed to be added, despite the daily limit?
+func (policy *TokenPolicy) isOperator(address string) bool {
+	for _, operator := range policy.Operators {
+		if operator == address {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateTokenAmount allowed by the policy.  Fails if this amount would
+// push us over the daily limit.  Allowed if limits are disabled
+func (filter *OperationFilter) evaluateTokenAmount(policy *TokenPolicy, value *big.Int) *FilterDecision {
+	if policy.dailyMax == nil {
+		return allow("token-policy-file", policy.Name, "no daily limit is set")
+	}
+	account := fmt.Sprintf("token:%v:%v", policy.Contract, policy.TokenID)
+	total, authorized, err := filter.authorize(account, policy.dailyMax, value)
+	if err != nil {
+		return denyWith(ReasonBackendError, "token-policy-file", policy.Name, "unable to read the ledger: "+err.Error())
+	}
+	debugln("[evaluateTokenAmount] token", policy.Name, "authorized result: ", authorized)
+	reason := fmt.Sprintf("%v of the daily max of %v spent", total, policy.dailyMax)
+	if !authorized {
+		return denyWith(ReasonLimitExceeded, "token-policy-file", policy.Name, reason)
+	}
+	decision := allow("token-policy-file", policy.Name, reason)
+	decision.spend = &Spend{Account: account, Amount: value, Max: policy.dailyMax}
+	return decision
+}
+
+// tokenTransfers decodes the movements of tokens made by a call to one of
+// the FA1.2 or FA2 entrypoints.  Any other entrypoint is an error.
+// FA1.2: https://gitlab.com/tezos/tzip/-/blob/master/proposals/tzip-7/tzip-7.md
+// FA2: https://gitlab.com/tezos/tzip/-/blob/master/proposals/tzip-12/tzip-12.md
+func tokenTransfers(tx *Transaction) ([]*tokenTransfer, error) {
+	if tx.Parameters == nil {
+		return nil, fmt.Errorf("token call has no parameters")
+	}
+	value := tx.Parameters.Value
+
+	switch tx.Parameters.Entrypoint {
+	case "transfer":
+		// FA1.2: (pair (address :from) (pair (address :to) (nat :value)))
+		if args := pairArgs(value, 3); args != nil {
+			to, err := michelineAddress(args[1])
+			if err != nil || !isNat(args[2]) {
+				return nil, fmt.Errorf("invalid FA1.2 transfer")
+			}
+			return []*tokenTransfer{{To: to, Amount: args[2].Int}}, nil
+		}
+		// FA2: (list (pair (address %from_) (list %txs (pair (address %to_) (pair (nat %token_id) (nat %amount))))))
+		if value.Kind != michelineSeq {
+			return nil, fmt.Errorf("invalid token transfer")
+		}
+		transfers := []*tokenTransfer{}
+		for _, batch := range value.Args {
+			batchArgs := pairArgs(batch, 2)
+			if batchArgs == nil || batchArgs[1].Kind != michelineSeq {
+				return nil, fmt.Errorf("invalid FA2 transfer")
+			}
+			for _, txArg := range batchArgs[1].Args {
+				args := pairArgs(txArg, 3)
+				if args == nil || !isNat(args[1]) || !isNat(args[2]) {
+					return nil, fmt.Errorf("invalid FA2 transfer destination")
+				}
+				to, err := michelineAddress(args[0])
+				if err != nil {
+					return nil, err
+				}
+				transfers = append(transfers, &tokenTransfer{TokenID: args[1].Int, To: to, Amount: args[2].Int})
+			}
+		}
+		return transfers, nil
+	case "approve":
+		// FA1.2: (pair (address :spender) (nat :value))
+		args := pairArgs(value, 2)
+		if args == nil || !isNat(args[1]) {
+			return nil, fmt.Errorf("invalid FA1.2 approve")
+		}
+		spender, err := michelineAddress(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*tokenTransfer{{To: spender, Amount: args[1].Int}}, nil
+	case "update_operators":
+		// FA2: (list (or (pair %add_operator ...) (pair %remove_operator ...)))
+		// with (pair (address %owner) (pair (address %operator) (nat %token_id)))
+		if value.Kind != michelineSeq {
+			return nil, fmt.Errorf("invalid FA2 update_operators")
+		}
+		transfers := []*tokenTransfer{}
+		for _, update := range value.Args {
+			if update.IsPrim("Right", 1) {
+				// Removing an operator never moves tokens
+				continue
+			}
+			if !update.IsPrim("Left", 1) {
+				return nil, fmt.Errorf("invalid FA2 operator update")
+			}
+			args := pairArgs(update.Args[0], 3)
+			if args == nil || !isNat(args[2]) {
+				return nil, fmt.Errorf("invalid FA2 operator")
+			}
+			operator, err := michelineAddress(args[1])
+			if err != nil {
+				return nil, err
+			}
+			transfers = append(transfers, &tokenTransfer{TokenID: args[2].Int, To: operator, Amount: new(big.Int), Operator: true})
+		}
+		return transfers, nil
+	default:
+		return nil, fmt.Errorf("unsupported token entrypoint %v", tx.Parameters.Entrypoint)
+	}
+}
+
+// pairArgs flattens a right comb of pairs into exactly n values, accepting
+// both nested pairs and the (Pair a b c) shorthand.  Returns nil if the value
+// is not such a comb.
+func pairArgs(expr *Micheline, n int) []*Micheline {
+	args := []*Micheline{}
+	for len(args) < n-1 {
+		if expr == nil || expr.Kind != michelinePrim || expr.Prim != "Pair" || len(expr.Args) < 2 {
+			return nil
+		}
+		args = append(args, expr.Args[0])
+		if len(expr.Args) > 2 {
+			expr = &Micheline{Kind: michelinePrim, Prim: "Pair", Args: expr.Args[1:]}
+		} else {
+			expr = expr.Args[1]
+		}
+	}
+	if expr.IsPrim("Pair", len(expr.Args)) && len(expr.Args) > 1 {
+		// More values than expected
+		return nil
+	}
+	return append(args, expr)
+}
+
+// isNat is true for non-negative integers
+func isNat(expr *Micheline) bool {
+	return expr.Kind == michelineInt && expr.Int.Sign() >= 0
+}
+
+// michelineAddress as a base58 string from either its readable or its
+// optimized binary form
+func michelineAddress(expr *Micheline) (string, error) {
+	switch expr.Kind {
+	case michelineString:
+		return expr.String, nil
+	case michelineBytes:
+		return newDecoder(expr.Bytes).readContractID()
+	default:
+		return "", fmt.Errorf("invalid address")
+	}
+}
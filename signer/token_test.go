@@ -0,0 +1,84 @@
+package signer
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"testing"
+)
+
+const testTokenContract = "KT1JexcFezMnUAaWmvUGY99jwTA4jcKiUgFp"
+
+func testTokenFilter() *OperationFilter {
+	return &OperationFilter{
+		TokenPolicies: []*TokenPolicy{{
+			Name:               "FA1.2",
+			Contract:           testTokenContract,
+			WhitelistAddresses: []string{"tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"},
+			dailyMax:           big.NewInt(150),
+		}},
+	}
+}
+
+func testTokenCall(t *testing.T, filter *OperationFilter, name string, entrypoint string, value string, expected bool) {
+	op, err := ParseOperation([]byte(testContractCall(1, entrypoint, value)))
+	if err != nil {
+		log.Printf("[Token Test - %v] Unable to parse: %v\n", name, err)
+		t.Fail()
+		return
+	}
+	if filter.IsAllowed(op) != expected {
+		log.Printf("[Token Test - %v] Expected allowed to be %v\n", name, expected)
+		t.Fail()
+	}
+}
+
+func TestFA12Policy(t *testing.T) {
+	from := testMichelineString("tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m")
+	whitelisted := testMichelineString("tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf")
+	other := testMichelineString("tz3bh5VbXnLMyHGUMfhRKYzVXQE1axzTm9FN")
+
+	filter := testTokenFilter()
+	testTokenCall(t, filter, "Whitelisted Transfer", "transfer", testMichelinePair(from, testMichelinePair(whitelisted, "00a401")), true)
+	testTokenCall(t, filter, "Comb Transfer", "transfer", fmt.Sprintf("0907%08x%v%v0001", len(from+whitelisted)/2+2, from, whitelisted)+"00000000", true)
+	testTokenCall(t, filter, "Off Whitelist Transfer", "transfer", testMichelinePair(from, testMichelinePair(other, "0001")), false)
+	testTokenCall(t, filter, "Off Whitelist Approve", "approve", testMichelinePair(other, "0001"), false)
+	testTokenCall(t, filter, "Over Daily Max", "transfer", testMichelinePair(from, testMichelinePair(whitelisted, "0032")), false)
+	testTokenCall(t, filter, "Unknown Entrypoint", "mint", testMichelinePair(whitelisted, "0001"), false)
+
+	// Tez transfers are unaffected by token policies
+	op, _ := ParseOperation([]byte(testSecp256k1Tx.Operation))
+	if filter.IsAllowed(op) {
+		log.Println("[Token Test] Tez transfers should still require --enable-tx")
+		t.Fail()
+	}
+}
+
+func TestFA2Policy(t *testing.T) {
+	owner := testMichelineString("tz2G4TwEbsdFrJmApAxJ1vdQGmADnBp95n9m")
+	whitelisted := testMichelineString("tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf")
+	other := testMichelineString("tz3bh5VbXnLMyHGUMfhRKYzVXQE1axzTm9FN")
+	transfer := func(to string, tokenID string, amount string) string {
+		return testMichelineSeq(testMichelinePair(owner, testMichelineSeq(testMichelinePair(to, testMichelinePair(tokenID, amount)))))
+	}
+
+	filter := testTokenFilter()
+	filter.TokenPolicies[0].TokenID = "0"
+	testTokenCall(t, filter, "FA2 Transfer", "transfer", transfer(whitelisted, "0000", "0005"), true)
+	testTokenCall(t, filter, "FA2 Other Token", "transfer", transfer(whitelisted, "0001", "0005"), false)
+	testTokenCall(t, filter, "FA2 Off Whitelist", "transfer", transfer(other, "0000", "0005"), false)
+
+	addOperator := func(operator string) string {
+		return testMichelineSeq("0505" + testMichelinePair(owner, testMichelinePair(operator, "0000")))
+	}
+	removeOperator := testMichelineSeq("0508" + testMichelinePair(owner, testMichelinePair(other, "0000")))
+	testTokenCall(t, filter, "FA2 Add Operator Over Daily Max", "update_operators", addOperator(whitelisted), false)
+	testTokenCall(t, filter, "FA2 Add Off Whitelist Operator", "update_operators", addOperator(other), false)
+	testTokenCall(t, filter, "FA2 Remove Operator", "update_operators", removeOperator, true)
+
+	filter.TokenPolicies[0].Operators = []string{"tz1YTMAqhU9icfuDG6FQDdsgWQB4izbSfNSf"}
+	testTokenCall(t, filter, "FA2 Add Allowed Operator", "update_operators", addOperator(whitelisted), true)
+	filter.TokenPolicies[0].Operators = nil
+	filter.TokenPolicies[0].dailyMax = nil
+	testTokenCall(t, filter, "FA2 Add Operator Without Daily Max", "update_operators", addOperator(whitelisted), true)
+}
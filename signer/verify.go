@@ -0,0 +1,101 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ed25519"
+)
+
+// publicKeyCurves by the prefix of b58 encoded public keys, with the
+// prefixes of their bytes, hashes and signatures
+var publicKeyCurves = []struct {
+	prefix        string
+	curve         int
+	keyPrefix     string
+	hashPrefix    string
+	sigPrefix     string
+	sigNamePrefix string
+}{
+	{"edpk", curveEd25519, tzEd25519PublicKey, tzEd25519PublicKeyHash, tzEd25519Signature, "edsig"},
+	{"sppk", curveSecp256k1, tzSecp256k1PublicKey, tzSecp256k1PublicKeyHash, tzSecp256k1Signature, "spsig1"},
+	{"p2pk", curveNistP256, tzP256PublicKey, tzP256PublicKeyHash, tzP256Signature, "p2sig"},
+}
+
+// PublicKeyHash of a b58 encoded public key, e.g. the tz1 address of an edpk
+func PublicKeyHash(publicKey string) (string, error) {
+	for _, c := range publicKeyCurves {
+		if !strings.HasPrefix(publicKey, c.prefix) {
+			continue
+		}
+		keyBytes, err := b58CheckDecode(publicKey, c.keyPrefix)
+		if err != nil {
+			return "", err
+		}
+		hash, _ := blake2b.New(20, nil)
+		hash.Write(keyBytes)
+		prefix, _ := hex.DecodeString(c.hashPrefix)
+		return b58CheckEncode(prefix, hash.Sum(nil)), nil
+	}
+	return "", fmt.Errorf("unsupported public key %q", publicKey)
+}
+
+// VerifySignature of the message by the b58 encoded public key.  Like
+// tezos-client, the signature is of the message's 32 byte Blake2b hash.
+// Signatures may use the curve's prefix, e.g. edsig, or the generic sig.
+func VerifySignature(publicKey string, message []byte, signature string) error {
+	for _, c := range publicKeyCurves {
+		if !strings.HasPrefix(publicKey, c.prefix) {
+			continue
+		}
+		keyBytes, err := b58CheckDecode(publicKey, c.keyPrefix)
+		if err != nil {
+			return err
+		}
+		sigPrefix := c.sigPrefix
+		if !strings.HasPrefix(signature, c.sigNamePrefix) {
+			sigPrefix = tzGenericSignature
+		}
+		sig, err := b58CheckDecode(signature, sigPrefix)
+		if err != nil {
+			return err
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("signature is %v bytes, expected 64", len(sig))
+		}
+		digest := blake2b.Sum256(message)
+		if !verifyDigest(c.curve, keyBytes, digest[:], sig) {
+			return fmt.Errorf("invalid signature by %v", publicKey)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key %q", publicKey)
+}
+
+// verifyDigest signed by the raw public key on the curve
+func verifyDigest(curve int, publicKey []byte, digest []byte, sig []byte) bool {
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	switch curve {
+	case curveEd25519:
+		return len(publicKey) == ed25519.PublicKeySize && ed25519.Verify(ed25519.PublicKey(publicKey), digest, sig)
+	case curveSecp256k1:
+		key, err := btcec.ParsePubKey(publicKey, btcec.S256())
+		if err != nil {
+			return false
+		}
+		return (&btcec.Signature{R: r, S: s}).Verify(digest, key)
+	case curveNistP256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), publicKey)
+		if x == nil {
+			return false
+		}
+		return ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest, r, s)
+	}
+	return false
+}
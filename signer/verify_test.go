@@ -0,0 +1,95 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ed25519"
+)
+
+// testKeyPair of a new key on the curve, returning its b58 encoded public key
+// and a function signing messages like tezos-client
+func testKeyPair(t *testing.T, curve int) (string, func(message []byte) string) {
+	prefix := func(p string) []byte {
+		b, _ := hex.DecodeString(p)
+		return b
+	}
+	switch curve {
+	case curveEd25519:
+		public, private, _ := ed25519.GenerateKey(rand.Reader)
+		return b58CheckEncode(prefix(tzEd25519PublicKey), public), func(message []byte) string {
+			digest := blake2b.Sum256(message)
+			return b58CheckEncode(prefix(tzEd25519Signature), ed25519.Sign(private, digest[:]))
+		}
+	case curveSecp256k1:
+		private, _ := btcec.NewPrivateKey(btcec.S256())
+		return b58CheckEncode(prefix(tzSecp256k1PublicKey), private.PubKey().SerializeCompressed()), func(message []byte) string {
+			digest := blake2b.Sum256(message)
+			sig, _ := private.Sign(digest[:])
+			return b58CheckEncode(prefix(tzSecp256k1Signature), append(leftPad(sig.R.Bytes(), 32), leftPad(sig.S.Bytes(), 32)...))
+		}
+	case curveNistP256:
+		private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		public := elliptic.MarshalCompressed(elliptic.P256(), private.X, private.Y)
+		return b58CheckEncode(prefix(tzP256PublicKey), public), func(message []byte) string {
+			digest := blake2b.Sum256(message)
+			r, s, _ := ecdsa.Sign(rand.Reader, private, digest[:])
+			return b58CheckEncode(prefix(tzP256Signature), append(leftPad(r.Bytes(), 32), leftPad(s.Bytes(), 32)...))
+		}
+	}
+	t.FailNow()
+	return "", nil
+}
+
+func TestVerifySignature(t *testing.T) {
+	for _, curve := range []int{curveEd25519, curveSecp256k1, curveNistP256} {
+		publicKey, sign := testKeyPair(t, curve)
+		other, _ := testKeyPair(t, curve)
+		message := []byte("approve 1234")
+		signature := sign(message)
+
+		if err := VerifySignature(publicKey, message, signature); err != nil {
+			log.Printf("[Verify Test] %v: Expected a valid signature: %v\n", publicKey[:4], err)
+			t.Fail()
+		}
+		if VerifySignature(publicKey, []byte("reject 1234"), signature) == nil {
+			log.Printf("[Verify Test] %v: Expected the signature of another message to be invalid\n", publicKey[:4])
+			t.Fail()
+		}
+		if VerifySignature(other, message, signature) == nil {
+			log.Printf("[Verify Test] %v: Expected the signature of another key to be invalid\n", publicKey[:4])
+			t.Fail()
+		}
+		corrupt := signature[:len(signature)-1] + "1"
+		if strings.HasSuffix(signature, "1") {
+			corrupt = signature[:len(signature)-1] + "2"
+		}
+		if VerifySignature(publicKey, message, corrupt) == nil {
+			log.Printf("[Verify Test] %v: Expected a bad checksum to be invalid\n", publicKey[:4])
+			t.Fail()
+		}
+
+		pkh, err := PublicKeyHash(publicKey)
+		expected := map[int]string{curveEd25519: "tz1", curveSecp256k1: "tz2", curveNistP256: "tz3"}[curve]
+		if err != nil || !strings.HasPrefix(pkh, expected) || len(pkh) != 36 {
+			log.Printf("[Verify Test] %v: Expected a %v public key hash, received %v: %v\n", publicKey[:4], expected, pkh, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestPublicKeyHash(t *testing.T) {
+	// The first bootstrap account of sandboxes
+	pkh, err := PublicKeyHash("edpkuBknW28nW72KG6RoHtYW7p12T6GKc7nAbwYX5m8Wd9sDVC9yav")
+	if err != nil || pkh != "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" {
+		log.Printf("[Public Key Hash Test] Expected tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx, received %v: %v\n", pkh, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,39 @@
+package signer
+
+import "fmt"
+
+// evaluateVote of ballots and proposals against the allowed proposals and
+// ballot values.  Returns nil for other kinds.
+func (filter *OperationFilter) evaluateVote(subject string, content OperationContent) *FilterDecision {
+	switch c := content.(type) {
+	case *Ballot:
+		if filter.VotingProposals != nil && !containsString(filter.VotingProposals, c.Proposal) {
+			return deny("voting-proposals", subject, "voting on "+c.Proposal+" is not allowed")
+		}
+		if filter.VotingBallots != nil && !containsString(filter.VotingBallots, c.Value()) {
+			return deny("voting-ballots", subject, "voting "+c.Value()+" is not allowed")
+		}
+		return allow("voting-ballots", subject, fmt.Sprintf("voting %v on %v in period %v is allowed", c.Value(), c.Proposal, c.Period))
+	case *Proposals:
+		if filter.VotingProposals != nil {
+			for _, proposal := range c.Proposals {
+				if !containsString(filter.VotingProposals, proposal) {
+					return deny("voting-proposals", subject, "proposing "+proposal+" is not allowed")
+				}
+			}
+		}
+		return allow("voting-proposals", subject, fmt.Sprintf("proposing %v in period %v is allowed", c.Proposals, c.Period))
+	default:
+		return nil
+	}
+}
+
+// CheckBallotValues are each yay, nay or pass
+func CheckBallotValues(values []string) error {
+	for _, value := range values {
+		if !containsString(ballotValues, value) {
+			return fmt.Errorf("%q is not a ballot value, expected one of %v", value, ballotValues)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package signer
+
+import (
+	"log"
+	"testing"
+)
+
+const (
+	testProposal  = "\"03ce69c5713dac3537254e7be59759cf59c15abd530d10501ccf9028a5786314cf05008fb5cea62d147c696afd9a93dbce962f4c8a9c910000000a00000020ab22e46e7872aa13e366e455bb4f5dbede856ab0864e1da7e122554579ee71f8\""
+	testOtherHash = "PsDELPH1Kxsxt8f9eWbxQeRxkjfbxoqM52jvs5Y5fBxWWh4ifpo"
+)
+
+// testBallot forges a ballot in period 11 with the value's tag
+func testBallot(tag string) string {
+	return "\"03ce69c5713dac3537254e7be59759cf59c15abd530d10501ccf9028a5786314cf0600531ab5764a29f77c5d40b80a5da45c84468f08a10000000bab22e46e7872aa13e366e455bb4f5dbede856ab0864e1da7e122554579ee71f8" + tag + "\""
+}
+
+func TestParseBallotValue(t *testing.T) {
+	for tag, expected := range map[string]string{"00": "yay", "01": "nay", "02": "pass"} {
+		op, _ := ParseOperation([]byte(testBallot(tag)))
+		contents, err := GetGenericOperation(op).Contents()
+		if err != nil || len(contents) != 1 {
+			log.Printf("[Ballot Value Test] Unable to decode ballot %v: %v\n", tag, err)
+			t.FailNow()
+		}
+		ballot := contents[0].(*Ballot)
+		if ballot.Value() != expected || ballot.Period != 11 {
+			log.Printf("[Ballot Value Test] Expected %v in period 11, received %v in %v\n", expected, ballot.Value(), ballot.Period)
+			t.Fail()
+		}
+	}
+}
+
+func TestVotingPolicy(t *testing.T) {
+	op, _ := ParseOperation([]byte(testProposal))
+	contents, _ := GetGenericOperation(op).Contents()
+	hash := contents[0].(*Proposals).Proposals[0]
+
+	filter := &OperationFilter{EnableVoting: true, VotingProposals: []string{hash}, VotingBallots: []string{"yay", "pass"}}
+	other := &OperationFilter{EnableVoting: true, VotingProposals: []string{testOtherHash}}
+	key := &Key{Name: "governance", Policy: &KeyPolicy{Ballots: []string{"nay"}}}
+
+	tests := []struct {
+		Name      string
+		Filter    *OperationFilter
+		Key       *Key
+		Operation string
+		Expected  bool
+	}{
+		{"Proposal", filter, nil, testProposal, true},
+		{"Other Proposal", other, nil, testProposal, false},
+		{"Yay", filter, nil, testBallot("00"), true},
+		{"Nay", filter, nil, testBallot("01"), false},
+		{"Pass", filter, nil, testBallot("02"), true},
+		{"Yay On Other Proposal", other, nil, testBallot("00"), false},
+		{"Key Nay", filter, key, testBallot("01"), true},
+		{"Key Yay", filter, key, testBallot("00"), false},
+		{"Voting Disabled", &OperationFilter{VotingBallots: []string{"yay"}}, nil, testBallot("00"), false},
+	}
+	for _, test := range tests {
+		testKeyPolicy(t, "[Voting Test - "+test.Name+"]", test.Filter, test.Key, test.Operation, test.Expected)
+	}
+
+	if CheckBallotValues([]string{"yay", "nay", "pass"}) != nil || CheckBallotValues([]string{"yes"}) == nil {
+		log.Println("[Voting Test] Expected only yay, nay and pass to be ballot values")
+		t.Fail()
+	}
+}
@@ -0,0 +1,74 @@
+package watermark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+)
+
+// ParseEntry returns the typed opMagicByte and level of an entry
+func ParseEntry(entry *Entry) (uint8, *big.Int, error) {
+	opType, err := strconv.ParseUint(entry.OpType, 10, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid op type %q for key %v", entry.OpType, entry.KeyHash)
+	}
+	level, ok := new(big.Int).SetString(entry.Level, 10)
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid level %q for key %v", entry.Level, entry.KeyHash)
+	}
+	return uint8(opType), level, nil
+}
+
+// Export writes every entry of the watermark as a JSON list
+func Export(w io.Writer, admin Admin) error {
+	entries, err := admin.Entries()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+// Import reads a JSON list written by Export into the watermark.  Entries only
+// ever raise the destination's levels so an import can never make it unsafe
+// to sign.  Returns the number of entries that were written.
+func Import(r io.Reader, admin Admin) (int, error) {
+	imported := []*Entry{}
+	if err := json.NewDecoder(r).Decode(&imported); err != nil {
+		return 0, err
+	}
+
+	existing, err := admin.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, entry := range imported {
+		opType, level, err := ParseEntry(entry)
+		if err != nil {
+			return written, err
+		}
+
+		skip := false
+		for _, current := range existing {
+			if current.matches(entry.KeyHash, entry.ChainID, entry.OpType) {
+				_, currentLevel, err := ParseEntry(current)
+				skip = err == nil && currentLevel.Cmp(level) >= 0
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+
+		if err := admin.SetLevel(entry.KeyHash, entry.ChainID, opType, level); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,45 @@
+package watermark
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestSetAndReset(t *testing.T) {
+	wm := GetSessionWatermark()
+	keyHash := "tz2..."
+	chainID := "NetXdQprcVkpaWU"
+	opTypeBlock := uint8(0x01)
+
+	assert(t, wm.IsSafeToSign(keyHash, chainID, opTypeBlock, big.NewInt(10)), "Level 10 should be safe to sign")
+	assert(t, wm.SetLevel(keyHash, chainID, opTypeBlock, big.NewInt(20)) == nil, "Setting a level should not fail")
+	assert(t, !wm.IsSafeToSign(keyHash, chainID, opTypeBlock, big.NewInt(15)), "Level 15 should be unsafe after setting level 20")
+
+	assert(t, wm.SetLevel(keyHash, chainID, opTypeBlock, big.NewInt(5)) == nil, "Lowering a level should not fail")
+	assert(t, wm.IsSafeToSign(keyHash, chainID, opTypeBlock, big.NewInt(6)), "Level 6 should be safe after lowering to level 5")
+
+	assert(t, wm.Reset(keyHash, chainID, opTypeBlock) == nil, "Resetting should not fail")
+	entries, _ := wm.Entries()
+	assert(t, len(entries) == 0, "Reset should remove the entry")
+	assert(t, wm.IsSafeToSign(keyHash, chainID, opTypeBlock, big.NewInt(1)), "Level 1 should be safe after a reset")
+}
+
+func TestExportImport(t *testing.T) {
+	source := GetSessionWatermark()
+	source.IsSafeToSign("tz2...", "NetXdQprcVkpaWU", 0x01, big.NewInt(100))
+	source.IsSafeToSign("tz2...", "NetXdQprcVkpaWU", 0x02, big.NewInt(200))
+
+	exported := &bytes.Buffer{}
+	assert(t, Export(exported, source) == nil, "Export should not fail")
+
+	// The destination is ahead for endorsements and should keep its level
+	destination := GetSessionWatermark()
+	destination.IsSafeToSign("tz2...", "NetXdQprcVkpaWU", 0x02, big.NewInt(300))
+
+	written, err := Import(exported, destination)
+	assert(t, err == nil, "Import should not fail")
+	assert(t, written == 1, "Import should only write entries that raise the level")
+	assert(t, !destination.IsSafeToSign("tz2...", "NetXdQprcVkpaWU", 0x01, big.NewInt(100)), "Imported block level should be enforced")
+	assert(t, !destination.IsSafeToSign("tz2...", "NetXdQprcVkpaWU", 0x02, big.NewInt(250)), "Import should not lower the endorsement level")
+}
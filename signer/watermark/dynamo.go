@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -37,6 +38,15 @@ func getDynamoKey(keyHash string, chainID string, opMagicByte uint8) string {
 	return fmt.Sprintf("%v-%v-%v", keyHash, chainID, opMagicByte)
 }
 
+// parseDynamoKey splits a hash identifier back into its (key, chainID, opMagicByte) parts
+func parseDynamoKey(dynamoKey string) (string, string, string, error) {
+	parts := strings.Split(dynamoKey, "-")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("unexpected watermark key: %v", dynamoKey)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
 // getCurrentLevel watermarked in Dynamo
 func (mw *DynamoWatermark) getCurrentLevel(keyHash string, chainID string, opMagicByte uint8) (*big.Int, error) {
 	// Get Item
@@ -96,6 +106,13 @@ func (mw *DynamoWatermark) updateItem(keyHash string, chainID string, opMagicByt
 // IsSafeToSign returns true if the provided (key, chainID, opMagicByte) tuple has
 // not yet been signed at this or greater levels
 func (mw *DynamoWatermark) IsSafeToSign(keyHash string, chainID string, opMagicByte uint8, level *big.Int) bool {
+	return mw.IsRangeSafeToSign(keyHash, chainID, opMagicByte, level, level)
+}
+
+// IsRangeSafeToSign returns true if the provided (key, chainID, opMagicByte)
+// tuple has not yet been signed at the lowest or greater levels, advancing it
+// to the highest
+func (mw *DynamoWatermark) IsRangeSafeToSign(keyHash string, chainID string, opMagicByte uint8, lowest *big.Int, highest *big.Int) bool {
 
 	currentLevel, err := mw.getCurrentLevel(keyHash, chainID, opMagicByte)
 	if err != nil {
@@ -105,7 +122,7 @@ func (mw *DynamoWatermark) IsSafeToSign(keyHash string, chainID string, opMagicB
 
 	// Create a new item if none currently exists
 	if currentLevel == nil {
-		err := mw.putItem(keyHash, chainID, opMagicByte, level)
+		err := mw.putItem(keyHash, chainID, opMagicByte, highest)
 		if err != nil {
 			return false
 		}
@@ -113,14 +130,72 @@ func (mw *DynamoWatermark) IsSafeToSign(keyHash string, chainID string, opMagicB
 	}
 
 	// Update existing items
-	if level.Cmp(currentLevel) != 1 {
+	if lowest.Cmp(currentLevel) != 1 {
 		log.Println("Warning: Attempted to sign at an unsafe level. Will not allow.")
 		return false
 	} else {
-		err := mw.updateItem(keyHash, chainID, opMagicByte, currentLevel, level)
+		err := mw.updateItem(keyHash, chainID, opMagicByte, currentLevel, highest)
 		if err != nil {
 			return false
 		}
 		return true
 	}
 }
+
+// Entries scans the table and returns every watermark entry
+func (mw *DynamoWatermark) Entries() ([]*Entry, error) {
+	entries := []*Entry{}
+	var parseErr error
+	err := mw.dynamodb.ScanPages(&dynamodb.ScanInput{
+		TableName:      aws.String(mw.table),
+		ConsistentRead: aws.Bool(true),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if item["KeyChainOp"] == nil || item["Level"] == nil {
+				continue
+			}
+			keyHash, chainID, opType, err := parseDynamoKey(*item["KeyChainOp"].S)
+			if err != nil {
+				parseErr = err
+				return false
+			}
+			entries = append(entries, &Entry{
+				KeyHash: keyHash,
+				ChainID: chainID,
+				OpType:  opType,
+				Level:   *item["Level"].S,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return entries, nil
+}
+
+// SetLevel unconditionally overwrites the level of the provided (key, chainID, opMagicByte) tuple
+func (mw *DynamoWatermark) SetLevel(keyHash string, chainID string, opMagicByte uint8, level *big.Int) error {
+	_, err := mw.dynamodb.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(mw.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"KeyChainOp": {S: aws.String(getDynamoKey(keyHash, chainID, opMagicByte))},
+			"Level":      {S: aws.String(level.String())},
+		},
+	})
+	return err
+}
+
+// Reset deletes the provided (key, chainID, opMagicByte) tuple
+func (mw *DynamoWatermark) Reset(keyHash string, chainID string, opMagicByte uint8) error {
+	_, err := mw.dynamodb.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(mw.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"KeyChainOp": {S: aws.String(getDynamoKey(keyHash, chainID, opMagicByte))},
+		},
+	})
+	return err
+}
@@ -45,8 +45,8 @@ func GetFileWatermark(file string) *FileWatermark {
 	return &wm
 }
 
-func loadFromDisk(file string) ([]*watermarkEntry, error) {
-	watermarkEntries := []*watermarkEntry{}
+func loadFromDisk(file string) ([]*Entry, error) {
+	watermarkEntries := []*Entry{}
 
 	// If file doesn't exist, return empty
 	if _, err := os.Stat(file); os.IsNotExist(err) {
@@ -85,11 +85,18 @@ func (wm *FileWatermark) saveToDisk() error {
 // IsSafeToSign returns true if the provided (key, chainID, opType) tuple has
 // not yet been signed at this or greater levels
 func (wm *FileWatermark) IsSafeToSign(keyHash string, chainID string, opType uint8, level *big.Int) bool {
+	return wm.IsRangeSafeToSign(keyHash, chainID, opType, level, level)
+}
+
+// IsRangeSafeToSign returns true if the provided (key, chainID, opType) tuple
+// has not yet been signed at the lowest or greater levels, advancing it to
+// the highest
+func (wm *FileWatermark) IsRangeSafeToSign(keyHash string, chainID string, opType uint8, lowest *big.Int, highest *big.Int) bool {
 	wm.mux.Lock()
 	defer wm.mux.Unlock()
 
 	// Verify logic is safe
-	isSessionSafe := wm.session.IsSafeToSign(keyHash, chainID, opType, level)
+	isSessionSafe := wm.session.IsRangeSafeToSign(keyHash, chainID, opType, lowest, highest)
 
 	// Update File
 	err := wm.saveToDisk()
@@ -98,3 +105,36 @@ func (wm *FileWatermark) IsSafeToSign(keyHash string, chainID string, opType uin
 	}
 	return isSessionSafe
 }
+
+// Entries returns a copy of all watermark entries stored in the file
+func (wm *FileWatermark) Entries() ([]*Entry, error) {
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+
+	return wm.session.Entries()
+}
+
+// SetLevel overwrites the level of the provided (key, chainID, opType) tuple
+// and persists the result
+func (wm *FileWatermark) SetLevel(keyHash string, chainID string, opType uint8, level *big.Int) error {
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+
+	err := wm.session.SetLevel(keyHash, chainID, opType, level)
+	if err != nil {
+		return err
+	}
+	return wm.saveToDisk()
+}
+
+// Reset removes the provided (key, chainID, opType) tuple and persists the result
+func (wm *FileWatermark) Reset(keyHash string, chainID string, opType uint8) error {
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+
+	err := wm.session.Reset(keyHash, chainID, opType)
+	if err != nil {
+		return err
+	}
+	return wm.saveToDisk()
+}
@@ -16,3 +16,8 @@ func GetIgnoreWatermark() Watermark {
 func (mw *IgnoreWatermark) IsSafeToSign(keyHash string, chainID string, opType uint8, level *big.Int) bool {
 	return true
 }
+
+// IsRangeSafeToSign is always true when we're ignoring the watermark
+func (mw *IgnoreWatermark) IsRangeSafeToSign(keyHash string, chainID string, opType uint8, lowest *big.Int, highest *big.Int) bool {
+	return true
+}
@@ -0,0 +1,154 @@
+package watermark
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+)
+
+// QuorumWatermark wraps several watermarks and only allows signing when a
+// quorum of them successfully advance.  Every backend is always asked to
+// advance, so a backend that is behind catches up on the next safe level,
+// while a backend that is ahead or unreachable counts as a refusal.
+type QuorumWatermark struct {
+	backends []Watermark
+	quorum   int
+}
+
+// GetQuorumWatermark returns a watermark requiring `quorum` of the provided
+// backends to agree.  The quorum must be a strict majority so that two
+// conflicting requests at the same level can never both reach it.
+func GetQuorumWatermark(quorum int, backends ...Watermark) *QuorumWatermark {
+	if len(backends) == 0 {
+		log.Fatal("A quorum watermark requires at least one backend")
+	}
+	if quorum*2 <= len(backends) || quorum > len(backends) {
+		log.Fatalf("Watermark quorum must be a majority of the %v backends, received %v\n", len(backends), quorum)
+	}
+	return &QuorumWatermark{
+		backends: backends,
+		quorum:   quorum,
+	}
+}
+
+// IsSafeToSign returns true if at least a quorum of backends consider the
+// provided (key, chainID, opType) tuple safe to sign at this level
+func (qw *QuorumWatermark) IsSafeToSign(keyHash string, chainID string, opType uint8, level *big.Int) bool {
+	return qw.IsRangeSafeToSign(keyHash, chainID, opType, level, level)
+}
+
+// IsRangeSafeToSign returns true if at least a quorum of backends consider
+// the provided (key, chainID, opType) tuple safe to sign from the lowest to
+// the highest level
+func (qw *QuorumWatermark) IsRangeSafeToSign(keyHash string, chainID string, opType uint8, lowest *big.Int, highest *big.Int) bool {
+	results := make([]bool, len(qw.backends))
+	wg := sync.WaitGroup{}
+	for i, backend := range qw.backends {
+		wg.Add(1)
+		go func(i int, backend Watermark) {
+			defer wg.Done()
+			results[i] = backend.IsRangeSafeToSign(keyHash, chainID, opType, lowest, highest)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	agreed := 0
+	for i, safe := range results {
+		if safe {
+			agreed++
+		} else {
+			log.Printf("Warning: Watermark backend #%v refused to sign at level %v\n", i, lowest)
+		}
+	}
+	if agreed < qw.quorum {
+		log.Printf("Warning: Only %v of %v watermark backends agreed, %v required\n", agreed, len(qw.backends), qw.quorum)
+		return false
+	}
+	return true
+}
+
+// admins returns every backend as an Admin, failing if any can't be administered
+func (qw *QuorumWatermark) admins() ([]Admin, error) {
+	admins := make([]Admin, 0, len(qw.backends))
+	for _, backend := range qw.backends {
+		admin, ok := backend.(Admin)
+		if !ok {
+			return nil, errors.New("quorum contains a watermark that does not support administration")
+		}
+		admins = append(admins, admin)
+	}
+	return admins, nil
+}
+
+// Entries returns the highest level of every entry across a quorum of backends
+func (qw *QuorumWatermark) Entries() ([]*Entry, error) {
+	admins, err := qw.admins()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := []*Entry{}
+	responded := 0
+	var lastErr error
+	for _, admin := range admins {
+		entries, err := admin.Entries()
+		if err != nil {
+			log.Println("Warning: Unable to list entries of a watermark backend:", err)
+			lastErr = err
+			continue
+		}
+		responded++
+		for _, entry := range entries {
+			merged = mergeEntry(merged, entry)
+		}
+	}
+	if responded < qw.quorum {
+		return nil, lastErr
+	}
+	return merged, nil
+}
+
+// mergeEntry into the list, keeping the highest level of each tuple
+func mergeEntry(entries []*Entry, entry *Entry) []*Entry {
+	for _, existing := range entries {
+		if existing.matches(entry.KeyHash, entry.ChainID, entry.OpType) {
+			existingLevel, ok := new(big.Int).SetString(existing.Level, 10)
+			level, ok2 := new(big.Int).SetString(entry.Level, 10)
+			if ok && ok2 && level.Cmp(existingLevel) == 1 {
+				existing.Level = entry.Level
+			}
+			return entries
+		}
+	}
+	entryCopy := *entry
+	return append(entries, &entryCopy)
+}
+
+// SetLevel on every backend
+func (qw *QuorumWatermark) SetLevel(keyHash string, chainID string, opType uint8, level *big.Int) error {
+	admins, err := qw.admins()
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if err := admin.SetLevel(keyHash, chainID, opType, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset on every backend
+func (qw *QuorumWatermark) Reset(keyHash string, chainID string, opType uint8) error {
+	admins, err := qw.admins()
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if err := admin.Reset(keyHash, chainID, opType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
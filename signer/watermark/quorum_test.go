@@ -0,0 +1,47 @@
+package watermark
+
+import (
+	"math/big"
+	"testing"
+)
+
+// unreachableWatermark refuses every request, like a backend that can't be reached
+type unreachableWatermark struct{}
+
+func (mw *unreachableWatermark) IsSafeToSign(keyHash string, chainID string, opType uint8, level *big.Int) bool {
+	return false
+}
+
+func (mw *unreachableWatermark) IsRangeSafeToSign(keyHash string, chainID string, opType uint8, lowest *big.Int, highest *big.Int) bool {
+	return false
+}
+
+func TestQuorumUnreachable(t *testing.T) {
+	keyHash := "tz2..."
+	chainID := "NetXdQprcVkpaWU"
+
+	wm := GetQuorumWatermark(2, GetSessionWatermark(), GetSessionWatermark(), &unreachableWatermark{})
+	assert(t, wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(1)), "Two of three backends should reach quorum")
+	assert(t, !wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(1)), "The same level should fail")
+
+	wm = GetQuorumWatermark(2, GetSessionWatermark(), &unreachableWatermark{}, &unreachableWatermark{})
+	assert(t, !wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(1)), "One of three backends should not reach quorum")
+}
+
+func TestQuorumBehind(t *testing.T) {
+	keyHash := "tz2..."
+	chainID := "NetXdQprcVkpaWU"
+
+	ahead := GetSessionWatermark()
+	ahead.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(10))
+	behind := GetSessionWatermark()
+	wm := GetQuorumWatermark(2, ahead, behind, GetSessionWatermark())
+
+	// A single backend ahead is outvoted, but still refuses lower levels
+	assert(t, wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(5)), "Two backends behind should reach quorum")
+	assert(t, !wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(5)), "The same level should fail")
+	assert(t, wm.IsSafeToSign(keyHash, chainID, 0x01, big.NewInt(11)), "Levels above every backend should be safe")
+
+	entries, err := wm.Entries()
+	assert(t, err == nil && len(entries) == 1 && entries[0].Level == "11", "Entries should merge to the highest level")
+}
@@ -8,7 +8,7 @@ import (
 
 // SessionWatermark stores the last-signed level in memory
 type SessionWatermark struct {
-	watermarkEntries []*watermarkEntry
+	watermarkEntries []*Entry
 	mux              sync.Mutex
 }
 
@@ -16,7 +16,7 @@ type SessionWatermark struct {
 func GetSessionWatermark() *SessionWatermark {
 	// Initialize with an empty watermark entry
 	return &SessionWatermark{
-		watermarkEntries: []*watermarkEntry{},
+		watermarkEntries: []*Entry{},
 		mux:              sync.Mutex{},
 	}
 }
@@ -24,30 +24,86 @@ func GetSessionWatermark() *SessionWatermark {
 // IsSafeToSign returns true if the provided (key, chainID, opType) tuple has
 // not yet been signed at this or greater levels
 func (mw *SessionWatermark) IsSafeToSign(keyHash string, chainID string, opType uint8, level *big.Int) bool {
+	return mw.IsRangeSafeToSign(keyHash, chainID, opType, level, level)
+}
+
+// IsRangeSafeToSign returns true if the provided (key, chainID, opType) tuple
+// has not yet been signed at the lowest or greater levels, advancing it to
+// the highest
+func (mw *SessionWatermark) IsRangeSafeToSign(keyHash string, chainID string, opType uint8, lowest *big.Int, highest *big.Int) bool {
 	mw.mux.Lock()
 	defer mw.mux.Unlock()
 
 	sOpType := strconv.Itoa(int(opType))
 
 	for _, entry := range mw.watermarkEntries {
-		if entry.KeyHash == keyHash && entry.ChainID == chainID && entry.OpType == sOpType {
+		if entry.matches(keyHash, chainID, sOpType) {
 			iLevel, ok := new(big.Int).SetString(entry.Level, 10)
 			if !ok {
 				return false
 			}
-			// If the new level is > last level, update level and return true
-			if level.Cmp(iLevel) == 1 {
-				entry.Level = level.String()
+			// If the lowest level is > last level, update level and return true
+			if lowest.Cmp(iLevel) == 1 {
+				entry.Level = highest.String()
 				return true
 			}
 			return false
 		}
 	}
-	mw.watermarkEntries = append(mw.watermarkEntries, &watermarkEntry{
+	mw.watermarkEntries = append(mw.watermarkEntries, &Entry{
 		KeyHash: keyHash,
 		ChainID: chainID,
 		OpType:  strconv.Itoa(int(opType)),
-		Level:   level.String(),
+		Level:   highest.String(),
 	})
 	return true
 }
+
+// Entries returns a copy of all watermark entries held in memory
+func (mw *SessionWatermark) Entries() ([]*Entry, error) {
+	mw.mux.Lock()
+	defer mw.mux.Unlock()
+
+	entries := make([]*Entry, 0, len(mw.watermarkEntries))
+	for _, entry := range mw.watermarkEntries {
+		entryCopy := *entry
+		entries = append(entries, &entryCopy)
+	}
+	return entries, nil
+}
+
+// SetLevel overwrites the level of the provided (key, chainID, opType) tuple
+func (mw *SessionWatermark) SetLevel(keyHash string, chainID string, opType uint8, level *big.Int) error {
+	mw.mux.Lock()
+	defer mw.mux.Unlock()
+
+	sOpType := strconv.Itoa(int(opType))
+	for _, entry := range mw.watermarkEntries {
+		if entry.matches(keyHash, chainID, sOpType) {
+			entry.Level = level.String()
+			return nil
+		}
+	}
+	mw.watermarkEntries = append(mw.watermarkEntries, &Entry{
+		KeyHash: keyHash,
+		ChainID: chainID,
+		OpType:  sOpType,
+		Level:   level.String(),
+	})
+	return nil
+}
+
+// Reset removes the provided (key, chainID, opType) tuple
+func (mw *SessionWatermark) Reset(keyHash string, chainID string, opType uint8) error {
+	mw.mux.Lock()
+	defer mw.mux.Unlock()
+
+	sOpType := strconv.Itoa(int(opType))
+	for i, entry := range mw.watermarkEntries {
+		if entry.matches(keyHash, chainID, sOpType) {
+			mw.watermarkEntries = append(mw.watermarkEntries[:i], mw.watermarkEntries[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
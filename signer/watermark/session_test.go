@@ -51,3 +51,14 @@ func TestSameLevel(t *testing.T) {
 	assert(t, !wm.IsSafeToSign(keyHash, chainIDAlphanet, opTypeBlock, lvl1), "Testnet:Block:1 at lower levels should fail")
 	assert(t, !wm.IsSafeToSign(keyHash, chainIDAlphanet, opTypeEndorsement, lvl1), "Testnet:Endorsement:1 at lower levels should fail")
 }
+
+func TestRangeLevel(t *testing.T) {
+	wm := GetSessionWatermark()
+	keyHash := "tz2..."
+	chainID := "NetXdQprcVkpaWU"
+
+	assert(t, wm.IsRangeSafeToSign(keyHash, chainID, 0x03, big.NewInt(2), big.NewInt(4)), "2 to 4 should be safe to sign")
+	assert(t, !wm.IsSafeToSign(keyHash, chainID, 0x03, big.NewInt(4)), "The highest level should be watermarked")
+	assert(t, !wm.IsRangeSafeToSign(keyHash, chainID, 0x03, big.NewInt(4), big.NewInt(6)), "A range starting at the watermark should fail")
+	assert(t, wm.IsRangeSafeToSign(keyHash, chainID, 0x03, big.NewInt(5), big.NewInt(6)), "A range above the watermark should be safe")
+}
@@ -10,12 +10,33 @@ type Watermark interface {
 	// IsSafeToSign returns true if the provided (key, chainID, opType) tuple has
 	// not yet been signed at this or greater levels
 	IsSafeToSign(keyHash string, chainID string, opMagicByte uint8, level *big.Int) bool
+	// IsRangeSafeToSign returns true if the provided (key, chainID, opType)
+	// tuple has not yet been signed at the lowest or greater levels, and
+	// advances it to the highest.  Used for batches of manager operations,
+	// whose counters must all be unsigned.
+	IsRangeSafeToSign(keyHash string, chainID string, opMagicByte uint8, lowest *big.Int, highest *big.Int) bool
 }
 
-// watermarkEntry stores our locks
-type watermarkEntry struct {
-	KeyHash string `yaml:"Key"`
-	ChainID string `yaml:"ChainID"`
-	OpType  string `yaml:"OpType"`
-	Level   string `yaml:"Level"`
+// Admin is implemented by watermarks whose entries can be inspected and
+// repaired by an operator
+type Admin interface {
+	// Entries returns a copy of every (key, chainID, opType) entry
+	Entries() ([]*Entry, error)
+	// SetLevel overwrites the level of an entry, creating it if needed
+	SetLevel(keyHash string, chainID string, opMagicByte uint8, level *big.Int) error
+	// Reset removes an entry entirely
+	Reset(keyHash string, chainID string, opMagicByte uint8) error
+}
+
+// Entry stores our locks
+type Entry struct {
+	KeyHash string `yaml:"Key" json:"key"`
+	ChainID string `yaml:"ChainID" json:"chain_id"`
+	OpType  string `yaml:"OpType" json:"op_type"`
+	Level   string `yaml:"Level" json:"level"`
+}
+
+// Matches this entry's (key, chainID, opType) tuple?
+func (entry *Entry) matches(keyHash string, chainID string, opType string) bool {
+	return entry.KeyHash == keyHash && entry.ChainID == chainID && entry.OpType == opType
 }